@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrBearerTokenInvalid = errors.New("invalid bearer token")
+	ErrBearerTokenMissing = errors.New("missing bearer token")
+)
+
+// bearerOptions holds the configuration of the BearerAuthenticate middleware.
+type bearerOptions struct {
+	realm      string
+	cookieName string
+	queryParam string
+	leeway     time.Duration
+	jwtOptions []JWTOption
+}
+
+// BearerOption configures the BearerAuthenticate middleware.
+type BearerOption func(*bearerOptions)
+
+// WithBearerRealm sets the realm of the WWW-Authenticate challenge.
+func WithBearerRealm(realm string) BearerOption {
+	return func(o *bearerOptions) {
+		o.realm = realm
+	}
+}
+
+// WithBearerCookie reads the token from the given cookie when the Authorization header is missing.
+func WithBearerCookie(name string) BearerOption {
+	return func(o *bearerOptions) {
+		o.cookieName = name
+	}
+}
+
+// WithBearerQuery reads the token from the given query parameter when the Authorization header is missing.
+// Tokens in URLs end up in logs and browser history, reserve it for clients unable to set headers such as WebSockets.
+func WithBearerQuery(param string) BearerOption {
+	return func(o *bearerOptions) {
+		o.queryParam = param
+	}
+}
+
+// WithBearerLeeway sets the leeway of the token time validation.
+func WithBearerLeeway(leeway time.Duration) BearerOption {
+	return func(o *bearerOptions) {
+		o.leeway = leeway
+	}
+}
+
+// WithBearerJWTOptions sets the options of the token parsing, such as the expected issuer and audience.
+func WithBearerJWTOptions(options ...JWTOption) BearerOption {
+	return func(o *bearerOptions) {
+		o.jwtOptions = append(o.jwtOptions, options...)
+	}
+}
+
+// BearerAuthenticate authenticates the user with a JWT bearer token (RFC 6750) and sets the identity in the context.
+// The token is read from the Authorization header and, if configured, from a cookie or a query parameter.
+// On failure, the WWW-Authenticate challenge is set before calling handleError, which is expected to respond with a 401.
+func BearerAuthenticate(
+	keys KeySet,
+	identify func(context.Context, Claims) (any, error),
+	handleError func(http.ResponseWriter, *http.Request, error),
+	options ...BearerOption,
+) func(http.Handler) http.Handler {
+	opts := &bearerOptions{}
+
+	for _, option := range options {
+		option(opts)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := opts.token(r)
+			if token == "" {
+				w.Header().Set("WWW-Authenticate", opts.challenge("", ""))
+				handleError(w, r, ErrBearerTokenMissing)
+				return
+			}
+
+			jwtOptions := append([]JWTOption{WithContext(r.Context())}, opts.jwtOptions...)
+
+			claims, err := ParseJWT(keys, token, opts.leeway, jwtOptions...)
+			if err != nil {
+				// the token may be valid, the failure comes from the revocation store.
+				if !errors.Is(err, ErrJWTRevocationCheckFailure) {
+					w.Header().Set("WWW-Authenticate", opts.challenge("invalid_token", tokenErrorDescription(err)))
+				}
+
+				handleError(w, r, fmt.Errorf("%w: %w", ErrBearerTokenInvalid, err))
+				return
+			}
+
+			identity, err := identify(r.Context(), claims)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", opts.challenge("invalid_token", "The access token does not identify a user"))
+				handleError(w, r, fmt.Errorf("%w: %w", ErrAuthIdentifyFailure, err))
+				return
+			}
+
+			ctx := setIdentity(r.Context(), identity)
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// token returns the bearer token of the request or an empty string if there is none.
+func (o *bearerOptions) token(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+
+	if o.cookieName != "" {
+		cookie, err := r.Cookie(o.cookieName)
+		if err == nil && cookie.Value != "" {
+			return cookie.Value
+		}
+	}
+
+	if o.queryParam != "" {
+		return r.URL.Query().Get(o.queryParam)
+	}
+
+	return ""
+}
+
+// challenge returns the WWW-Authenticate header value with the given error code and description if any.
+func (o *bearerOptions) challenge(code, description string) string {
+	params := []string{}
+
+	if o.realm != "" {
+		params = append(params, fmt.Sprintf("realm=%q", o.realm))
+	}
+
+	if code != "" {
+		params = append(params, fmt.Sprintf("error=%q", code), fmt.Sprintf("error_description=%q", description))
+	}
+
+	if len(params) == 0 {
+		return "Bearer"
+	}
+
+	return "Bearer " + strings.Join(params, ", ")
+}
+
+// tokenErrorDescription returns a description of the token parsing failure
+// that does not disclose more than the client needs to know.
+func tokenErrorDescription(err error) string {
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return "The access token expired"
+	case errors.Is(err, ErrJWTRevoked):
+		return "The access token has been revoked"
+	default:
+		return "The access token is invalid"
+	}
+}
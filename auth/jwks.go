@@ -0,0 +1,293 @@
+package auth
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math/big"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrJWKSDecodeFailure = errors.New("failed to decode JWKS")
+	ErrJWKSEncodeFailure = errors.New("failed to encode JWKS")
+)
+
+// JWKSPath is the conventional path of the JWKS endpoint.
+const JWKSPath = "/.well-known/jwks.json"
+
+// jwkSetContentType is the media type of a JWK set (RFC 7517 section 8.5).
+const jwkSetContentType = "application/jwk-set+json"
+
+// jsonWebKey is the RFC 7517 representation of a public JWK.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// jsonWebKeySet is the RFC 7517 representation of a JWK set.
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// MarshalJSON encodes the public keys of the JWKS in the RFC 7517 JWK set format.
+// Symmetric keys and private key material are never encoded.
+func (jwks JWKS) MarshalJSON() ([]byte, error) {
+	set := jsonWebKeySet{
+		Keys: []jsonWebKey{},
+	}
+
+	// sorted for a stable output.
+	for _, kid := range slices.Sorted(maps.Keys(jwks)) {
+		key, ok, err := encodeJWK(jwks[kid])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrJWKSEncodeFailure, err)
+		}
+
+		if ok {
+			set.Keys = append(set.Keys, key)
+		}
+	}
+
+	return json.Marshal(set)
+}
+
+// UnmarshalJSON decodes a JWK set in the RFC 7517 format.
+// Keys without kid, not meant for signatures or of an unsupported type, curve or algorithm are ignored
+// so that a foreign key does not prevent the others from being used. Only malformed keys fail the decoding.
+func (jwks *JWKS) UnmarshalJSON(data []byte) error {
+	set := jsonWebKeySet{}
+
+	err := json.Unmarshal(data, &set)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrJWKSDecodeFailure, err)
+	}
+
+	decoded := JWKS{}
+
+	for _, key := range set.Keys {
+		if key.Kid == "" || (key.Use != "" && key.Use != "sig") {
+			continue
+		}
+
+		jwk, ok, err := decodeJWK(key)
+		if err != nil {
+			return fmt.Errorf("%w: key %q: %w", ErrJWKSDecodeFailure, key.Kid, err)
+		}
+
+		if ok {
+			decoded.Add(jwk)
+		}
+	}
+
+	*jwks = decoded
+
+	return nil
+}
+
+// JWKSHandler serves the public keys returned by keys in the RFC 7517 JWK set format,
+// allowing clients to cache them for maxAge.
+// It is meant to be mounted at JWKSPath.
+func JWKSHandler(keys func() JWKS, maxAge time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := json.Marshal(keys())
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", jwkSetContentType)
+		w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(maxAge.Seconds())))
+
+		_, _ = w.Write(body)
+	})
+}
+
+// encodeJWK returns the public representation of the JWK or false if it has none.
+func encodeJWK(jwk JWK) (jsonWebKey, bool, error) {
+	key := jsonWebKey{
+		Kid: jwk.Kid,
+		Alg: jwk.Alg(),
+		Use: "sig",
+	}
+
+	switch public := jwk.public().(type) {
+	case *rsa.PublicKey:
+		key.Kty = "RSA"
+		key.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		key.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (public.Curve.Params().BitSize + 7) / 8
+
+		key.Kty = "EC"
+		key.Crv = public.Curve.Params().Name
+		key.X = base64.RawURLEncoding.EncodeToString(public.X.FillBytes(make([]byte, size)))
+		key.Y = base64.RawURLEncoding.EncodeToString(public.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		key.Kty = "OKP"
+		key.Crv = "Ed25519"
+		key.X = base64.RawURLEncoding.EncodeToString(public)
+	case nil:
+		// symmetric keys must never be published.
+		return jsonWebKey{}, false, nil
+	default:
+		return jsonWebKey{}, false, fmt.Errorf("%w: unsupported public key type %T", ErrJWTKeyInvalid, public)
+	}
+
+	return key, true, nil
+}
+
+// decodeJWK returns the JWK of the public representation or false if it cannot verify the supported JWTs,
+// such as a key of an unsupported type or curve, or an encryption key.
+func decodeJWK(key jsonWebKey) (JWK, bool, error) {
+	jwk := JWK{
+		Kid:       key.Kid,
+		Algorithm: key.Alg,
+	}
+
+	switch key.Kty {
+	case "RSA":
+		n, err := decodeJWKInt(key.N)
+		if err != nil {
+			return JWK{}, false, err
+		}
+
+		e, err := decodeJWKInt(key.E)
+		if err != nil {
+			return JWK{}, false, err
+		}
+
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return JWK{}, false, fmt.Errorf("%w: invalid RSA exponent", ErrJWTKeyInvalid)
+		}
+
+		jwk.PublicKey = &rsa.PublicKey{N: n, E: int(e.Int64())}
+
+		if jwk.Algorithm == "" {
+			jwk.Algorithm = AlgRS256
+		}
+	case "EC":
+		public, alg, err := decodeECPublicKey(key)
+		if err != nil {
+			return JWK{}, false, err
+		}
+
+		if public == nil {
+			return JWK{}, false, nil
+		}
+
+		jwk.PublicKey = public
+
+		if jwk.Algorithm == "" {
+			jwk.Algorithm = alg
+		}
+	case "OKP":
+		if key.Crv != "Ed25519" {
+			return JWK{}, false, nil
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(key.X)
+		if err != nil {
+			return JWK{}, false, err
+		}
+
+		if len(x) != ed25519.PublicKeySize {
+			return JWK{}, false, fmt.Errorf("%w: invalid Ed25519 key size", ErrJWTKeyInvalid)
+		}
+
+		jwk.PublicKey = ed25519.PublicKey(x)
+
+		if jwk.Algorithm == "" {
+			jwk.Algorithm = AlgEdDSA
+		}
+	default:
+		return JWK{}, false, nil
+	}
+
+	// skips the keys of an unsupported algorithm or of an algorithm not matching their type.
+	_, err := jwk.verificationKey()
+	if err != nil {
+		return JWK{}, false, nil
+	}
+
+	return jwk, true, nil
+}
+
+// decodeECPublicKey decodes an EC public key and returns it with its default algorithm,
+// or a nil key if its curve is unsupported.
+func decodeECPublicKey(key jsonWebKey) (*ecdsa.PublicKey, string, error) {
+	var (
+		curve elliptic.Curve
+		point ecdh.Curve
+		alg   string
+		size  int
+	)
+
+	switch key.Crv {
+	case "P-256":
+		curve, point, alg, size = elliptic.P256(), ecdh.P256(), AlgES256, 32
+	case "P-384":
+		curve, point, alg, size = elliptic.P384(), ecdh.P384(), AlgES384, 48
+	case "P-521":
+		curve, point, alg, size = elliptic.P521(), ecdh.P521(), AlgES512, 66
+	default:
+		return nil, "", nil
+	}
+
+	x, err := base64.RawURLEncoding.DecodeString(key.X)
+	if err != nil {
+		return nil, "", err
+	}
+
+	y, err := base64.RawURLEncoding.DecodeString(key.Y)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(x) != size || len(y) != size {
+		return nil, "", fmt.Errorf("%w: invalid coordinate size", ErrJWTKeyInvalid)
+	}
+
+	// rejects the points that are not on the curve.
+	_, err = point.NewPublicKey(slices.Concat([]byte{4}, x, y))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %w", ErrJWTKeyInvalid, err)
+	}
+
+	return &ecdsa.PublicKey{
+		Curve: curve,
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}, alg, nil
+}
+
+// decodeJWKInt decodes a base64url encoded big-endian unsigned integer.
+func decodeJWKInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) == 0 {
+		return nil, fmt.Errorf("%w: missing integer", ErrJWTKeyInvalid)
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
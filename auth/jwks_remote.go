@@ -0,0 +1,280 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrRemoteJWKSFetchFailure = errors.New("failed to fetch remote JWKS")
+
+const (
+	// DefaultRemoteJWKSRefreshInterval is the lifetime of the cached keys when the response has no max-age.
+	DefaultRemoteJWKSRefreshInterval = time.Hour
+	// DefaultRemoteJWKSMinRefreshInterval is the minimum delay between two fetches.
+	DefaultRemoteJWKSMinRefreshInterval = time.Minute
+	// DefaultRemoteJWKSTimeout is the timeout of a fetch.
+	DefaultRemoteJWKSTimeout = 10 * time.Second
+)
+
+// remoteJWKSMaxSize is the maximum size of a remote JWKS response.
+const remoteJWKSMaxSize = 1 << 20
+
+// KeySet is a set of JWKs indexed by key ID.
+type KeySet interface {
+	GetByKid(kid string) (JWK, bool)
+}
+
+// remoteJWKSOptions holds the configuration of a RemoteJWKS.
+type remoteJWKSOptions struct {
+	client             *http.Client
+	refreshInterval    time.Duration
+	minRefreshInterval time.Duration
+	timeout            time.Duration
+}
+
+// RemoteJWKSOption configures a RemoteJWKS.
+type RemoteJWKSOption func(*remoteJWKSOptions)
+
+// WithHTTPClient sets the HTTP client fetching the keys. Defaults to http.DefaultClient.
+func WithHTTPClient(client *http.Client) RemoteJWKSOption {
+	return func(o *remoteJWKSOptions) {
+		o.client = client
+	}
+}
+
+// WithRefreshInterval sets the lifetime of the cached keys when the response has no max-age.
+// Defaults to DefaultRemoteJWKSRefreshInterval.
+func WithRefreshInterval(interval time.Duration) RemoteJWKSOption {
+	return func(o *remoteJWKSOptions) {
+		o.refreshInterval = interval
+	}
+}
+
+// WithMinRefreshInterval sets the minimum delay between two fetches,
+// limiting the fetches triggered by tokens with an unknown kid.
+// Defaults to DefaultRemoteJWKSMinRefreshInterval.
+func WithMinRefreshInterval(interval time.Duration) RemoteJWKSOption {
+	return func(o *remoteJWKSOptions) {
+		o.minRefreshInterval = interval
+	}
+}
+
+// WithFetchTimeout sets the timeout of a fetch. Defaults to DefaultRemoteJWKSTimeout.
+func WithFetchTimeout(timeout time.Duration) RemoteJWKSOption {
+	return func(o *remoteJWKSOptions) {
+		o.timeout = timeout
+	}
+}
+
+// RemoteJWKS is a key set fetched from a remote JWKS URL, typically an identity provider.
+//
+// The keys are cached for the max-age of the response and refreshed in the background
+// until Close is called. An unknown kid triggers a refetch, at most once per minimum refresh interval,
+// so that the keys rotated by the provider are picked up without waiting for the cache to expire.
+// Stale keys are kept when a refresh fails.
+type RemoteJWKS struct {
+	url     string
+	options remoteJWKSOptions
+
+	mu        sync.RWMutex
+	keys      JWKS
+	expiresAt time.Time
+
+	fetchMu   sync.Mutex
+	fetchedAt time.Time
+
+	done chan struct{}
+	once sync.Once
+}
+
+// NewRemoteJWKS creates a new remote key set fetching the keys from the given URL.
+func NewRemoteJWKS(url string, options ...RemoteJWKSOption) *RemoteJWKS {
+	opts := remoteJWKSOptions{
+		client:             http.DefaultClient,
+		refreshInterval:    DefaultRemoteJWKSRefreshInterval,
+		minRefreshInterval: DefaultRemoteJWKSMinRefreshInterval,
+		timeout:            DefaultRemoteJWKSTimeout,
+	}
+
+	for _, option := range options {
+		option(&opts)
+	}
+
+	s := &RemoteJWKS{
+		url:     url,
+		options: opts,
+		keys:    JWKS{},
+		done:    make(chan struct{}),
+	}
+
+	go s.refresher()
+
+	return s
+}
+
+// GetByKid returns the JWK with the given key ID, fetching the keys if it is unknown or the cache expired.
+func (s *RemoteJWKS) GetByKid(kid string) (JWK, bool) {
+	s.mu.RLock()
+	jwk, ok := s.keys.GetByKid(kid)
+	fresh := time.Now().Before(s.expiresAt)
+	s.mu.RUnlock()
+
+	if ok && fresh {
+		return jwk, true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.options.timeout)
+	defer cancel()
+
+	// a failed refresh keeps the stale keys.
+	_ = s.refresh(ctx, false)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.keys.GetByKid(kid)
+}
+
+// Keys returns a copy of the cached keys.
+func (s *RemoteJWKS) Keys() JWKS {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := JWKS{}
+
+	for _, jwk := range s.keys {
+		keys.Add(jwk)
+	}
+
+	return keys
+}
+
+// Refresh fetches the keys regardless of the cache and the minimum refresh interval.
+func (s *RemoteJWKS) Refresh(ctx context.Context) error {
+	return s.refresh(ctx, true)
+}
+
+// Close stops the background refresh.
+func (s *RemoteJWKS) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+	})
+
+	return nil
+}
+
+// refresh fetches the keys unless they were fetched less than the minimum refresh interval ago.
+// Concurrent refreshes are coalesced into a single fetch.
+func (s *RemoteJWKS) refresh(ctx context.Context, force bool) error {
+	s.fetchMu.Lock()
+	defer s.fetchMu.Unlock()
+
+	if !force && time.Since(s.fetchedAt) < s.options.minRefreshInterval {
+		return nil
+	}
+
+	s.fetchedAt = time.Now()
+
+	keys, ttl, err := s.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.expiresAt = time.Now().Add(ttl)
+	s.mu.Unlock()
+
+	return nil
+}
+
+// fetch fetches the keys and returns them with their cache lifetime.
+func (s *RemoteJWKS) fetch(ctx context.Context) (JWKS, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %w", ErrRemoteJWKSFetchFailure, err)
+	}
+
+	req.Header.Set("Accept", jwkSetContentType+", application/json")
+
+	res, err := s.options.client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %w", ErrRemoteJWKSFetchFailure, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("%w: unexpected status %d", ErrRemoteJWKSFetchFailure, res.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, remoteJWKSMaxSize))
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %w", ErrRemoteJWKSFetchFailure, err)
+	}
+
+	keys := JWKS{}
+
+	err = json.Unmarshal(body, &keys)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %w", ErrRemoteJWKSFetchFailure, err)
+	}
+
+	return keys, s.cacheLifetime(res.Header.Get("Cache-Control")), nil
+}
+
+// cacheLifetime returns the lifetime of the keys according to the Cache-Control header,
+// never shorter than the minimum refresh interval.
+func (s *RemoteJWKS) cacheLifetime(cacheControl string) time.Duration {
+	ttl := s.options.refreshInterval
+
+	for directive := range strings.SplitSeq(cacheControl, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+
+		switch strings.ToLower(name) {
+		case "no-cache", "no-store":
+			return s.options.minRefreshInterval
+		case "max-age":
+			seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+			if err == nil && seconds >= 0 {
+				ttl = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+
+	return max(ttl, s.options.minRefreshInterval)
+}
+
+// refresher refreshes the keys when the cache expires, retrying after the minimum refresh interval on failure.
+func (s *RemoteJWKS) refresher() {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-timer.C:
+			ctx, cancel := context.WithTimeout(context.Background(), s.options.timeout)
+			err := s.refresh(ctx, true)
+			cancel()
+
+			delay := s.options.minRefreshInterval
+
+			if err == nil {
+				s.mu.RLock()
+				delay = max(time.Until(s.expiresAt), delay)
+				s.mu.RUnlock()
+			}
+
+			timer.Reset(delay)
+		}
+	}
+}
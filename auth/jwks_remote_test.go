@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testJWKSServer serves a JWK set that can be swapped or made to fail.
+type testJWKSServer struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	body   []byte
+	failed bool
+}
+
+// newTestJWKSServer starts a server serving the public keys of the given JWKS,
+// along with a key of an unsupported curve that must be ignored.
+func newTestJWKSServer(t *testing.T, jwks JWKS) *testJWKSServer {
+	t.Helper()
+
+	s := &testJWKSServer{}
+	s.serve(t, jwks)
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if s.failed {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", jwkSetContentType)
+		w.Header().Set("Cache-Control", "max-age=3600")
+
+		_, _ = w.Write(s.body)
+	}))
+
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// serve serves the public keys of the given JWKS from now on.
+func (s *testJWKSServer) serve(t *testing.T, jwks JWKS) {
+	t.Helper()
+
+	body, err := json.Marshal(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := map[string][]map[string]any{}
+
+	err = json.Unmarshal(body, &set)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set["keys"] = append(set["keys"], map[string]any{
+		"kty": "EC",
+		"crv": "secp256k1",
+		"kid": "foreign",
+		"x":   "AA",
+		"y":   "AA",
+	})
+
+	body, err = json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.body = body
+	s.failed = false
+}
+
+// fail makes the server respond with an error from now on.
+func (s *testJWKSServer) fail() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failed = true
+}
+
+// newTestJWKS returns a JWKS holding a new key with the given kid and algorithm.
+func newTestJWKS(t *testing.T, kid, alg string) JWKS {
+	t.Helper()
+
+	jwk, err := GenerateJWK(kid, alg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return JWKS{kid: jwk}
+}
+
+func TestRemoteJWKS(t *testing.T) {
+	ctx := context.Background()
+
+	current := newTestJWKS(t, "current", AlgES256)
+	server := newTestJWKSServer(t, current)
+
+	keys := NewRemoteJWKS(server.URL, WithMinRefreshInterval(0))
+	t.Cleanup(func() { _ = keys.Close() })
+
+	token, err := GenerateJWT(current, nil, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ParseJWT(keys, token, 0)
+	if err != nil {
+		t.Fatalf("failed to verify a token of the remote key: %v", err)
+	}
+
+	if _, ok := keys.GetByKid("foreign"); ok {
+		t.Error("got the key of an unsupported curve")
+	}
+
+	// the provider rotates its key: the unknown kid triggers a refetch.
+	rotated := newTestJWKS(t, "rotated", AlgRS256)
+	server.serve(t, rotated)
+
+	token, err = GenerateJWT(rotated, nil, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ParseJWT(keys, token, 0)
+	if err != nil {
+		t.Fatalf("failed to verify a token of the rotated remote key: %v", err)
+	}
+
+	// a failed refresh keeps the stale keys.
+	server.fail()
+
+	err = keys.Refresh(ctx)
+	if !errors.Is(err, ErrRemoteJWKSFetchFailure) {
+		t.Errorf("got %v, want %v", err, ErrRemoteJWKSFetchFailure)
+	}
+
+	_, err = ParseJWT(keys, token, 0)
+	if err != nil {
+		t.Fatalf("failed to verify a token of the stale remote key: %v", err)
+	}
+}
+
+func TestRemoteJWKSCacheLifetime(t *testing.T) {
+	keys := &RemoteJWKS{
+		options: remoteJWKSOptions{
+			refreshInterval:    time.Hour,
+			minRefreshInterval: time.Minute,
+		},
+	}
+
+	tests := map[string]time.Duration{
+		"":                         time.Hour,
+		"public, max-age=7200":     2 * time.Hour,
+		"max-age=1":                time.Minute,
+		"no-store":                 time.Minute,
+		"max-age=invalid, private": time.Hour,
+	}
+
+	for cacheControl, want := range tests {
+		if got := keys.cacheLifetime(cacheControl); got != want {
+			t.Errorf("cacheLifetime(%q) = %v, want %v", cacheControl, got, want)
+		}
+	}
+}
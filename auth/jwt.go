@@ -1,9 +1,15 @@
 package auth
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
 	"errors"
 	"fmt"
 	"maps"
+	"slices"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -12,18 +18,184 @@ import (
 
 var (
 	ErrJWTActiveKeyMissing   = errors.New("missing active key")
+	ErrJWTAlgorithmMismatch  = errors.New("algorithm mismatch")
+	ErrJWTAlgorithmUnknown   = errors.New("unknown algorithm")
 	ErrJWTClaimsParseFailure = errors.New("failed to parse claims")
 	ErrJWTInvalid            = errors.New("invalid")
+	ErrJWTKeyInvalid         = errors.New("invalid key")
 	ErrJWTKidClaimMissing    = errors.New("missing kid claim")
 	ErrJWTKidClaimUnknown    = errors.New("unknown kid claim")
 	ErrJWTSignFailure        = errors.New("failed to sign")
 )
 
+// Supported JWT signing algorithms.
+const (
+	AlgHS256 = "HS256"
+	AlgHS384 = "HS384"
+	AlgHS512 = "HS512"
+	AlgRS256 = "RS256"
+	AlgRS384 = "RS384"
+	AlgRS512 = "RS512"
+	AlgPS256 = "PS256"
+	AlgPS384 = "PS384"
+	AlgPS512 = "PS512"
+	AlgES256 = "ES256"
+	AlgES384 = "ES384"
+	AlgES512 = "ES512"
+	AlgEdDSA = "EdDSA"
+)
+
+// jwtAlgorithms lists the supported JWT signing algorithms.
+var jwtAlgorithms = []string{
+	AlgHS256, AlgHS384, AlgHS512,
+	AlgRS256, AlgRS384, AlgRS512,
+	AlgPS256, AlgPS384, AlgPS512,
+	AlgES256, AlgES384, AlgES512,
+	AlgEdDSA,
+}
+
 // JWK represents a JSON Web Key.
+//
+// HMAC keys (HS*) hold their secret in Value.
+// Asymmetric keys hold an *rsa.PrivateKey (RS*, PS*), an *ecdsa.PrivateKey (ES*)
+// or an ed25519.PrivateKey (EdDSA) in PrivateKey, and the matching public key in PublicKey.
+// A key holding only a public key can verify but not sign.
 type JWK struct {
-	Kid    string
-	Value  []byte
-	Active bool
+	Kid        string
+	Algorithm  string
+	Value      []byte
+	PrivateKey crypto.PrivateKey
+	PublicKey  crypto.PublicKey
+	Active     bool
+}
+
+// Alg returns the signing algorithm of the JWK, defaulting to HS256.
+func (jwk JWK) Alg() string {
+	if jwk.Algorithm == "" {
+		return AlgHS256
+	}
+
+	return jwk.Algorithm
+}
+
+// signingMethod returns the JWT signing method of the JWK.
+func (jwk JWK) signingMethod() (jwt.SigningMethod, error) {
+	if !slices.Contains(jwtAlgorithms, jwk.Alg()) {
+		return nil, fmt.Errorf("%w: %s", ErrJWTAlgorithmUnknown, jwk.Alg())
+	}
+
+	return jwt.GetSigningMethod(jwk.Alg()), nil
+}
+
+// signingKey returns the key signing the JWTs.
+func (jwk JWK) signingKey() (any, error) {
+	switch jwk.Alg() {
+	case AlgHS256, AlgHS384, AlgHS512:
+		if len(jwk.Value) == 0 {
+			return nil, fmt.Errorf("%w: missing secret", ErrJWTKeyInvalid)
+		}
+
+		return jwk.Value, nil
+	case AlgRS256, AlgRS384, AlgRS512, AlgPS256, AlgPS384, AlgPS512:
+		key, ok := jwk.PrivateKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: expected *rsa.PrivateKey, got %T", ErrJWTKeyInvalid, jwk.PrivateKey)
+		}
+
+		return key, nil
+	case AlgES256, AlgES384, AlgES512:
+		key, ok := jwk.PrivateKey.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: expected *ecdsa.PrivateKey, got %T", ErrJWTKeyInvalid, jwk.PrivateKey)
+		}
+
+		err := checkCurve(jwk.Alg(), key.Curve)
+		if err != nil {
+			return nil, err
+		}
+
+		return key, nil
+	case AlgEdDSA:
+		key, ok := jwk.PrivateKey.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: expected ed25519.PrivateKey, got %T", ErrJWTKeyInvalid, jwk.PrivateKey)
+		}
+
+		return key, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrJWTAlgorithmUnknown, jwk.Alg())
+	}
+}
+
+// verificationKey returns the key verifying the JWTs,
+// derived from the private key when the public key is missing.
+func (jwk JWK) verificationKey() (any, error) {
+	public := jwk.public()
+
+	switch jwk.Alg() {
+	case AlgHS256, AlgHS384, AlgHS512:
+		if len(jwk.Value) == 0 {
+			return nil, fmt.Errorf("%w: missing secret", ErrJWTKeyInvalid)
+		}
+
+		return jwk.Value, nil
+	case AlgRS256, AlgRS384, AlgRS512, AlgPS256, AlgPS384, AlgPS512:
+		key, ok := public.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: expected *rsa.PublicKey, got %T", ErrJWTKeyInvalid, public)
+		}
+
+		return key, nil
+	case AlgES256, AlgES384, AlgES512:
+		key, ok := public.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: expected *ecdsa.PublicKey, got %T", ErrJWTKeyInvalid, public)
+		}
+
+		err := checkCurve(jwk.Alg(), key.Curve)
+		if err != nil {
+			return nil, err
+		}
+
+		return key, nil
+	case AlgEdDSA:
+		key, ok := public.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: expected ed25519.PublicKey, got %T", ErrJWTKeyInvalid, public)
+		}
+
+		return key, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrJWTAlgorithmUnknown, jwk.Alg())
+	}
+}
+
+// public returns the public key of the JWK, derived from the private key if missing.
+func (jwk JWK) public() crypto.PublicKey {
+	if jwk.PublicKey != nil {
+		return jwk.PublicKey
+	}
+
+	if signer, ok := jwk.PrivateKey.(crypto.Signer); ok {
+		return signer.Public()
+	}
+
+	return nil
+}
+
+// checkCurve checks that the elliptic curve matches the ECDSA algorithm.
+func checkCurve(alg string, curve elliptic.Curve) error {
+	expected := map[string]elliptic.Curve{
+		AlgES256: elliptic.P256(),
+		AlgES384: elliptic.P384(),
+		AlgES512: elliptic.P521(),
+	}[alg]
+
+	if curve != expected {
+		return fmt.Errorf("%w: curve %s does not match %s", ErrJWTKeyInvalid, curve.Params().Name, alg)
+	}
+
+	return nil
 }
 
 // JWKS represents a map of JSON Web Keys.
@@ -46,30 +218,37 @@ func (jwks JWKS) Remove(jwk JWK) {
 	delete(jwks, jwk.Kid)
 }
 
-// GetActive returns the first active JWK or the first JWK if none are active.
+// GetActive returns the active JWK with the greatest kid or, if none are active, the JWK with the greatest kid.
+// With time-ordered kids such as UUIDv7, it is the most recent key.
 func (jwks JWKS) GetActive() (JWK, bool) {
-	for _, jwk := range jwks {
-		if jwk.Active {
-			return jwk, true
-		}
+	if len(jwks) == 0 {
+		return JWK{}, false
 	}
 
-	for _, jwk := range jwks {
-		return jwk, true
+	kids := slices.Sorted(maps.Keys(jwks))
+
+	for _, kid := range slices.Backward(kids) {
+		if jwks[kid].Active {
+			return jwks[kid], true
+		}
 	}
 
-	return JWK{}, false
+	return jwks[kids[len(kids)-1]], true
 }
 
 // Claims represents the claims of a JWT.
 type Claims map[string]any
 
 // GenerateJWT generates a JWT.
+// The claims set by the options take precedence over the custom claims.
 func GenerateJWT(
 	jwks JWKS,
 	customClaims Claims,
 	ttl time.Duration,
+	options ...JWTOption,
 ) (string, error) {
+	opts := newJWTOptions(options)
+
 	jwk, ok := jwks.GetActive()
 	if !ok {
 		return "", ErrJWTActiveKeyMissing
@@ -84,14 +263,31 @@ func GenerateJWT(
 
 	maps.Copy(claims, customClaims)
 
+	opts.apply(claims)
+
+	err := opts.requirePresence(claims)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrJWTSignFailure, err)
+	}
+
+	method, err := jwk.signingMethod()
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrJWTSignFailure, err)
+	}
+
+	key, err := jwk.signingKey()
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrJWTSignFailure, err)
+	}
+
 	token := jwt.NewWithClaims(
-		jwt.SigningMethodHS256,
+		method,
 		claims,
 	)
 
 	token.Header["kid"] = jwk.Kid
 
-	tokenString, err := token.SignedString(jwk.Value)
+	tokenString, err := token.SignedString(key)
 	if err != nil {
 		return "", fmt.Errorf("%w: %w", ErrJWTSignFailure, err)
 	}
@@ -100,11 +296,35 @@ func GenerateJWT(
 }
 
 // ParseJWT parses a JWT and returns its claims.
+// The keys are either a local JWKS or a RemoteJWKS.
+// The token algorithm must match the algorithm of the key identified by its kid header.
+// The claims required by the options are validated and reported as ErrJWTInvalid.
 func ParseJWT(
-	jwks JWKS,
+	keys KeySet,
 	bearer string,
 	leeway time.Duration,
+	options ...JWTOption,
 ) (Claims, error) {
+	mapClaims, err := parseJWT(keys, bearer, leeway, newJWTOptions(options))
+	if err != nil {
+		return Claims{}, err
+	}
+
+	claims := Claims{}
+
+	maps.Copy(claims, mapClaims)
+
+	return claims, nil
+}
+
+// parseJWT parses and validates a JWT and returns its claims.
+func parseJWT(
+	keys KeySet,
+	bearer string,
+	leeway time.Duration,
+	opts *jwtOptions,
+	parserOptions ...jwt.ParserOption,
+) (jwt.MapClaims, error) {
 	mapClaims := &jwt.MapClaims{}
 
 	token, err := jwt.ParseWithClaims(bearer, mapClaims, func(token *jwt.Token) (any, error) {
@@ -113,29 +333,42 @@ func ParseJWT(
 			return nil, ErrJWTKidClaimMissing
 		}
 
-		jwk, ok := jwks.GetByKid(kid)
+		jwk, ok := keys.GetByKid(kid)
 		if !ok {
 			return nil, ErrJWTKidClaimUnknown
 		}
 
-		return jwk.Value, nil
+		// prevents algorithm confusion, e.g. an RSA public key used as an HMAC secret.
+		if token.Method.Alg() != jwk.Alg() {
+			return nil, fmt.Errorf("%w: %s token for %s key", ErrJWTAlgorithmMismatch, token.Method.Alg(), jwk.Alg())
+		}
+
+		return jwk.verificationKey()
 	},
-		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}),
-		jwt.WithLeeway(leeway),
-		jwt.WithExpirationRequired(),
-		jwt.WithIssuedAt(),
+		append([]jwt.ParserOption{
+			jwt.WithValidMethods(jwtAlgorithms),
+			jwt.WithLeeway(leeway),
+			jwt.WithExpirationRequired(),
+			jwt.WithIssuedAt(),
+		}, parserOptions...)...,
 	)
 	if err != nil {
-		return Claims{}, fmt.Errorf("%w: %w", ErrJWTClaimsParseFailure, err)
+		return nil, fmt.Errorf("%w: %w", ErrJWTClaimsParseFailure, err)
 	}
 
 	if !token.Valid {
-		return Claims{}, ErrJWTInvalid
+		return nil, ErrJWTInvalid
 	}
 
-	claims := Claims{}
+	err = opts.validate(*mapClaims)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrJWTInvalid, err)
+	}
 
-	maps.Copy(claims, *mapClaims)
+	err = opts.checkRevocation(*mapClaims)
+	if err != nil {
+		return nil, err
+	}
 
-	return claims, nil
+	return *mapClaims, nil
 }
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrJWTAudienceInvalid = errors.New("invalid audience")
+	ErrJWTClaimMissing    = errors.New("missing claim")
+	ErrJWTIssuerInvalid   = errors.New("invalid issuer")
+	ErrJWTSubjectInvalid  = errors.New("invalid subject")
+)
+
+// jwtOptions holds the configuration of the JWT generation and parsing.
+type jwtOptions struct {
+	issuer          string
+	audience        []string
+	subject         string
+	requiredClaims  []string
+	ctx             context.Context
+	revocationStore RevocationStore
+}
+
+// JWTOption configures the generation and the parsing of a JWT.
+type JWTOption func(*jwtOptions)
+
+// WithIssuer sets the iss claim of the generated JWT and requires it when parsing.
+func WithIssuer(issuer string) JWTOption {
+	return func(o *jwtOptions) {
+		o.issuer = issuer
+	}
+}
+
+// WithAudience sets the aud claim of the generated JWT, as a string for a single audience
+// and as a list otherwise. When parsing, the aud claim must contain at least one of the audiences.
+func WithAudience(audience ...string) JWTOption {
+	return func(o *jwtOptions) {
+		o.audience = audience
+	}
+}
+
+// WithSubject sets the sub claim of the generated JWT and requires it when parsing.
+func WithSubject(subject string) JWTOption {
+	return func(o *jwtOptions) {
+		o.subject = subject
+	}
+}
+
+// WithRequiredClaims requires the given claims to be present in the generated and parsed JWT.
+func WithRequiredClaims(names ...string) JWTOption {
+	return func(o *jwtOptions) {
+		o.requiredClaims = append(o.requiredClaims, names...)
+	}
+}
+
+// newJWTOptions returns the configuration of the given options.
+func newJWTOptions(options []JWTOption) *jwtOptions {
+	opts := &jwtOptions{
+		ctx: context.Background(),
+	}
+
+	for _, option := range options {
+		option(opts)
+	}
+
+	return opts
+}
+
+// apply sets the configured standard claims.
+func (o *jwtOptions) apply(claims jwt.MapClaims) {
+	if o.issuer != "" {
+		claims["iss"] = o.issuer
+	}
+
+	switch len(o.audience) {
+	case 0:
+	case 1:
+		claims["aud"] = o.audience[0]
+	default:
+		claims["aud"] = slices.Clone(o.audience)
+	}
+
+	if o.subject != "" {
+		claims["sub"] = o.subject
+	}
+}
+
+// requirePresence checks that the required claims are present.
+func (o *jwtOptions) requirePresence(claims jwt.MapClaims) error {
+	for _, name := range o.requiredClaims {
+		if _, ok := claims[name]; !ok {
+			return fmt.Errorf("%w: %s", ErrJWTClaimMissing, name)
+		}
+	}
+
+	return nil
+}
+
+// validate checks the configured standard claims and the presence of the required claims.
+func (o *jwtOptions) validate(claims jwt.MapClaims) error {
+	if o.issuer != "" {
+		issuer, err := claims.GetIssuer()
+		if err != nil || issuer != o.issuer {
+			return fmt.Errorf("%w: %q", ErrJWTIssuerInvalid, issuer)
+		}
+	}
+
+	if len(o.audience) > 0 {
+		audience, err := claims.GetAudience()
+		if err != nil || !slices.ContainsFunc(audience, func(aud string) bool {
+			return slices.Contains(o.audience, aud)
+		}) {
+			return fmt.Errorf("%w: %q", ErrJWTAudienceInvalid, audience)
+		}
+	}
+
+	if o.subject != "" {
+		subject, err := claims.GetSubject()
+		if err != nil || subject != o.subject {
+			return fmt.Errorf("%w: %q", ErrJWTSubjectInvalid, subject)
+		}
+	}
+
+	return o.requirePresence(claims)
+}
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrJWTClaimsDecodeFailure = errors.New("failed to decode claims")
+	ErrJWTClaimsEncodeFailure = errors.New("failed to encode claims")
+)
+
+// RegisteredClaims are the registered claims of RFC 7519 to embed in typed claims.
+// The claims left empty are set by GenerateJWTFor.
+type RegisteredClaims = jwt.RegisteredClaims
+
+// GenerateJWTFor generates a JWT carrying the JSON encoding of the given typed claims.
+func GenerateJWTFor[T any](
+	jwks JWKS,
+	typedClaims T,
+	ttl time.Duration,
+	options ...JWTOption,
+) (string, error) {
+	encoded, err := json.Marshal(typedClaims)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrJWTClaimsEncodeFailure, err)
+	}
+
+	claims := Claims{}
+
+	// keeps the precision of large numbers that float64 would round.
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+
+	err = decoder.Decode(&claims)
+	if err != nil {
+		return "", fmt.Errorf("%w: claims must encode as a JSON object: %w", ErrJWTClaimsEncodeFailure, err)
+	}
+
+	return GenerateJWT(jwks, claims, ttl, options...)
+}
+
+// ParseJWTAs parses a JWT and decodes its claims into the given type.
+// The fields of a struct type without omitempty are required, a missing or mistyped field invalidates the JWT.
+func ParseJWTAs[T any](
+	keys KeySet,
+	bearer string,
+	leeway time.Duration,
+	options ...JWTOption,
+) (T, error) {
+	var typedClaims T
+
+	opts := newJWTOptions(options)
+	opts.requiredClaims = append(opts.requiredClaims, requiredJSONFields(reflect.TypeFor[T]())...)
+
+	// keeps the precision of large numbers as when generating.
+	claims, err := parseJWT(keys, bearer, leeway, opts, jwt.WithJSONNumber())
+	if err != nil {
+		return typedClaims, err
+	}
+
+	encoded, err := json.Marshal(claims)
+	if err != nil {
+		return typedClaims, fmt.Errorf("%w: %w", ErrJWTClaimsDecodeFailure, err)
+	}
+
+	err = json.Unmarshal(encoded, &typedClaims)
+	if err != nil {
+		return typedClaims, fmt.Errorf("%w: %w: %w", ErrJWTInvalid, ErrJWTClaimsDecodeFailure, err)
+	}
+
+	return typedClaims, nil
+}
+
+// requiredJSONFields returns the JSON names of the struct fields without omitempty,
+// including the fields of the embedded structs.
+func requiredJSONFields(t reflect.Type) []string {
+	t = indirect(t)
+
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	names := []string{}
+
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() || len(field.Index) > 1 && !embeddedChain(t, field.Index) {
+			continue
+		}
+
+		tag, ok := field.Tag.Lookup("json")
+		name, flags, _ := strings.Cut(tag, ",")
+
+		if name == "-" && flags == "" {
+			continue
+		}
+
+		// embedded structs without a name have their fields promoted.
+		if field.Anonymous && name == "" && indirect(field.Type).Kind() == reflect.Struct {
+			continue
+		}
+
+		if !ok || name == "" {
+			name = field.Name
+		}
+
+		if !strings.Contains(","+flags+",", ",omitempty,") && !strings.Contains(","+flags+",", ",omitzero,") {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// embeddedChain returns true if the field at the given index is promoted
+// through untagged embedded structs only, as encoding/json does.
+func embeddedChain(t reflect.Type, index []int) bool {
+	for _, i := range index[:len(index)-1] {
+		field := indirect(t).Field(i)
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.Anonymous || name != "" {
+			return false
+		}
+
+		t = field.Type
+	}
+
+	return true
+}
+
+// indirect returns the type pointed to by pointer types.
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	return t
+}
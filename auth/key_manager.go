@@ -0,0 +1,521 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrKeyGenerateFailure        = errors.New("failed to generate key")
+	ErrKeyRotateFailure          = errors.New("failed to rotate keys")
+	ErrKeyStorageFailure         = errors.New("key storage failure")
+	ErrKeyStorageVersionConflict = errors.New("keys modified concurrently")
+)
+
+const (
+	// DefaultKeyRotationInterval is the lifetime of an active signing key.
+	DefaultKeyRotationInterval = 30 * 24 * time.Hour
+	// DefaultKeyPrePublishPeriod is how long a new key is published before signing.
+	DefaultKeyPrePublishPeriod = 24 * time.Hour
+	// DefaultKeyCheckInterval is the interval between two rotation checks.
+	DefaultKeyCheckInterval = time.Hour
+)
+
+// rsaKeyBits is the size of the generated RSA keys.
+const rsaKeyBits = 3072
+
+// KeyState is the lifecycle state of a managed key.
+type KeyState string
+
+const (
+	// KeyStatePending keys are published for verification but do not sign yet,
+	// giving the clients caching the JWKS the time to fetch them before they are used.
+	KeyStatePending KeyState = "pending"
+	// KeyStateActive keys sign the JWTs.
+	KeyStateActive KeyState = "active"
+	// KeyStateRetired keys no longer sign but are published until the JWTs they signed expire.
+	KeyStateRetired KeyState = "retired"
+)
+
+// ManagedKey is a JWK with its lifecycle.
+type ManagedKey struct {
+	JWK         JWK
+	State       KeyState
+	CreatedAt   time.Time
+	ActivatedAt time.Time
+	RetiredAt   time.Time
+}
+
+// KeyStorage persists the keys of a key manager, shared by all the instances of an application.
+// Implementations must persist the private key material, encrypted at rest, for instance with MarshalManagedKey.
+type KeyStorage interface {
+	// Load loads the keys and their version, returning none and version zero if nothing was saved yet.
+	Load(ctx context.Context) ([]ManagedKey, int64, error)
+	// Save replaces the saved keys if the saved version equals the given version, incrementing it,
+	// and returns ErrKeyStorageVersionConflict otherwise.
+	Save(ctx context.Context, keys []ManagedKey, version int64) error
+}
+
+// keyManagerOptions holds the configuration of a KeyManager.
+type keyManagerOptions struct {
+	algorithm        string
+	rotationInterval time.Duration
+	prePublishPeriod time.Duration
+	maxTokenTTL      time.Duration
+	checkInterval    time.Duration
+}
+
+// KeyManagerOption configures a KeyManager.
+type KeyManagerOption func(*keyManagerOptions)
+
+// WithKeyAlgorithm sets the algorithm of the generated keys. Defaults to ES256.
+func WithKeyAlgorithm(alg string) KeyManagerOption {
+	return func(o *keyManagerOptions) {
+		o.algorithm = alg
+	}
+}
+
+// WithKeyRotationInterval sets the lifetime of an active signing key. Defaults to DefaultKeyRotationInterval.
+func WithKeyRotationInterval(interval time.Duration) KeyManagerOption {
+	return func(o *keyManagerOptions) {
+		o.rotationInterval = interval
+	}
+}
+
+// WithKeyPrePublishPeriod sets how long a new key is published before signing.
+// It must exceed the time the clients cache the JWKS. Defaults to DefaultKeyPrePublishPeriod.
+func WithKeyPrePublishPeriod(period time.Duration) KeyManagerOption {
+	return func(o *keyManagerOptions) {
+		o.prePublishPeriod = period
+	}
+}
+
+// WithKeyCheckInterval sets the interval between two background rotation checks. Defaults to DefaultKeyCheckInterval.
+func WithKeyCheckInterval(interval time.Duration) KeyManagerOption {
+	return func(o *keyManagerOptions) {
+		o.checkInterval = interval
+	}
+}
+
+// KeyManager rotates the signing keys of a JWKS.
+//
+// A new key is generated and published as pending the pre-publish period before the active key
+// reaches the rotation interval, then it is promoted to active and the previous active key is retired.
+// Retired keys are removed once the JWTs they signed have expired, after the max token TTL.
+// The keys are checked in the background until Close is called.
+//
+// Several instances may share the same storage: each rotation starts from the saved keys,
+// and the rotation saved first wins while the others adopt its keys.
+type KeyManager struct {
+	storage KeyStorage
+	options keyManagerOptions
+
+	rotateMu sync.Mutex
+
+	mu   sync.RWMutex
+	keys []ManagedKey
+	jwks JWKS
+
+	done chan struct{}
+	once sync.Once
+}
+
+// NewKeyManager creates a new key manager rotating the keys of the storage immediately,
+// generating the first key if there is none.
+// The maxTokenTTL is the longest lifetime of the JWTs signed with the keys.
+func NewKeyManager(
+	ctx context.Context,
+	storage KeyStorage,
+	maxTokenTTL time.Duration,
+	options ...KeyManagerOption,
+) (*KeyManager, error) {
+	opts := keyManagerOptions{
+		algorithm:        AlgES256,
+		rotationInterval: DefaultKeyRotationInterval,
+		prePublishPeriod: DefaultKeyPrePublishPeriod,
+		maxTokenTTL:      maxTokenTTL,
+		checkInterval:    DefaultKeyCheckInterval,
+	}
+
+	for _, option := range options {
+		option(&opts)
+	}
+
+	m := &KeyManager{
+		storage: storage,
+		options: opts,
+		done:    make(chan struct{}),
+	}
+
+	err := m.Rotate(ctx, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.checkInterval > 0 {
+		go m.rotator()
+	}
+
+	return m, nil
+}
+
+// JWKS returns the published keys, with the signing key marked as active.
+func (m *KeyManager) JWKS() JWKS {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	jwks := JWKS{}
+
+	for _, jwk := range m.jwks {
+		jwks.Add(jwk)
+	}
+
+	return jwks
+}
+
+// GetByKid returns the published JWK with the given key ID.
+func (m *KeyManager) GetByKid(kid string) (JWK, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.jwks.GetByKid(kid)
+}
+
+// Keys returns the managed keys.
+func (m *KeyManager) Keys() []ManagedKey {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return slices.Clone(m.keys)
+}
+
+// Rotate reloads the keys from the storage, advances their lifecycle at the given time and saves them if they changed.
+// If another instance saved the keys meanwhile, its keys are adopted instead.
+func (m *KeyManager) Rotate(ctx context.Context, now time.Time) error {
+	m.rotateMu.Lock()
+	defer m.rotateMu.Unlock()
+
+	keys, version, err := m.storage.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %w: %w", ErrKeyRotateFailure, ErrKeyStorageFailure, err)
+	}
+
+	rotated, changed, err := m.rotate(slices.Clone(keys), now)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrKeyRotateFailure, err)
+	}
+
+	if !changed {
+		m.set(keys)
+		return nil
+	}
+
+	err = m.storage.Save(ctx, rotated, version)
+	if errors.Is(err, ErrKeyStorageVersionConflict) {
+		keys, _, err = m.storage.Load(ctx)
+		if err != nil {
+			return fmt.Errorf("%w: %w: %w", ErrKeyRotateFailure, ErrKeyStorageFailure, err)
+		}
+
+		m.set(keys)
+
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w: %w: %w", ErrKeyRotateFailure, ErrKeyStorageFailure, err)
+	}
+
+	m.set(rotated)
+
+	return nil
+}
+
+// Close stops the background rotation.
+func (m *KeyManager) Close() error {
+	m.once.Do(func() {
+		close(m.done)
+	})
+
+	return nil
+}
+
+// rotate returns the keys at the given time and whether they changed.
+func (m *KeyManager) rotate(keys []ManagedKey, now time.Time) ([]ManagedKey, bool, error) {
+	changed := false
+
+	// removes the retired keys that no longer verify any unexpired JWT.
+	keys = slices.DeleteFunc(keys, func(key ManagedKey) bool {
+		expired := key.State == KeyStateRetired && !now.Before(key.RetiredAt.Add(m.options.maxTokenTTL))
+		changed = changed || expired
+
+		return expired
+	})
+
+	active := slices.IndexFunc(keys, func(key ManagedKey) bool {
+		return key.State == KeyStateActive
+	})
+
+	pending := slices.IndexFunc(keys, func(key ManagedKey) bool {
+		return key.State == KeyStatePending
+	})
+
+	// the very first key is activated immediately as nobody can verify JWTs yet.
+	if active == -1 && pending == -1 {
+		key, err := m.generate(now)
+		if err != nil {
+			return nil, false, err
+		}
+
+		key.State = KeyStateActive
+		key.ActivatedAt = now
+
+		return append(keys, key), true, nil
+	}
+
+	rotationAt := now
+
+	if active != -1 {
+		rotationAt = keys[active].ActivatedAt.Add(m.options.rotationInterval)
+	}
+
+	if pending == -1 && !now.Before(rotationAt.Add(-m.options.prePublishPeriod)) {
+		key, err := m.generate(now)
+		if err != nil {
+			return nil, false, err
+		}
+
+		keys = append(keys, key)
+		pending = len(keys) - 1
+		changed = true
+	}
+
+	if pending != -1 && !now.Before(rotationAt) && !now.Before(keys[pending].CreatedAt.Add(m.options.prePublishPeriod)) {
+		if active != -1 {
+			keys[active].State = KeyStateRetired
+			keys[active].RetiredAt = now
+		}
+
+		keys[pending].State = KeyStateActive
+		keys[pending].ActivatedAt = now
+		changed = true
+	}
+
+	return keys, changed, nil
+}
+
+// generate generates a new pending key with a time-ordered kid.
+func (m *KeyManager) generate(now time.Time) (ManagedKey, error) {
+	kid, err := uuid.NewV7()
+	if err != nil {
+		return ManagedKey{}, fmt.Errorf("%w: %w", ErrKeyGenerateFailure, err)
+	}
+
+	jwk, err := GenerateJWK(kid.String(), m.options.algorithm)
+	if err != nil {
+		return ManagedKey{}, err
+	}
+
+	return ManagedKey{
+		JWK:       jwk,
+		State:     KeyStatePending,
+		CreatedAt: now,
+	}, nil
+}
+
+// set replaces the keys and the published JWKS.
+func (m *KeyManager) set(keys []ManagedKey) {
+	jwks := JWKS{}
+
+	for _, key := range keys {
+		jwk := key.JWK
+		jwk.Active = key.State == KeyStateActive
+		jwks.Add(jwk)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.keys = keys
+	m.jwks = jwks
+}
+
+// rotator periodically rotates the keys, picking up the keys rotated by the other instances.
+func (m *KeyManager) rotator() {
+	ticker := time.NewTicker(m.options.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case now := <-ticker.C:
+			err := m.Rotate(context.Background(), now)
+			if err != nil {
+				slog.Error("failed to rotate keys", slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// GenerateJWK generates a new JWK for the given algorithm.
+func GenerateJWK(kid string, alg string) (JWK, error) {
+	jwk := JWK{
+		Kid:       kid,
+		Algorithm: alg,
+	}
+
+	var err error
+
+	switch alg {
+	case AlgHS256, AlgHS384, AlgHS512:
+		// a secret as long as the hash output, as recommended by RFC 7518.
+		jwk.Value = make([]byte, map[string]int{AlgHS256: 32, AlgHS384: 48, AlgHS512: 64}[alg])
+		_, err = rand.Read(jwk.Value)
+	case AlgRS256, AlgRS384, AlgRS512, AlgPS256, AlgPS384, AlgPS512:
+		jwk.PrivateKey, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgES256:
+		jwk.PrivateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgES384:
+		jwk.PrivateKey, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case AlgES512:
+		jwk.PrivateKey, err = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case AlgEdDSA:
+		_, jwk.PrivateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return JWK{}, fmt.Errorf("%w: %w: %s", ErrKeyGenerateFailure, ErrJWTAlgorithmUnknown, alg)
+	}
+
+	if err != nil {
+		return JWK{}, fmt.Errorf("%w: %w", ErrKeyGenerateFailure, err)
+	}
+
+	jwk.PublicKey = jwk.public()
+
+	return jwk, nil
+}
+
+// MemoryKeyStorage is an in-memory key storage, losing the keys on restart.
+type MemoryKeyStorage struct {
+	mu      sync.RWMutex
+	keys    []ManagedKey
+	version int64
+}
+
+// NewMemoryKeyStorage creates a new memory key storage.
+func NewMemoryKeyStorage() *MemoryKeyStorage {
+	return &MemoryKeyStorage{}
+}
+
+// Load loads the keys and their version.
+func (s *MemoryKeyStorage) Load(_ context.Context) ([]ManagedKey, int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return slices.Clone(s.keys), s.version, nil
+}
+
+// Save replaces the keys if the version matches the saved one.
+func (s *MemoryKeyStorage) Save(_ context.Context, keys []ManagedKey, version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if version != s.version {
+		return ErrKeyStorageVersionConflict
+	}
+
+	s.keys = slices.Clone(keys)
+	s.version++
+
+	return nil
+}
+
+// managedKeyJSON is the serialized form of a ManagedKey.
+type managedKeyJSON struct {
+	Kid         string    `json:"kid"`
+	Algorithm   string    `json:"alg"`
+	Secret      []byte    `json:"secret,omitempty"`
+	PrivateKey  []byte    `json:"private_key,omitempty"`
+	State       KeyState  `json:"state"`
+	CreatedAt   time.Time `json:"created_at"`
+	ActivatedAt time.Time `json:"activated_at"`
+	RetiredAt   time.Time `json:"retired_at"`
+}
+
+// MarshalManagedKey serializes the managed key, including its secret or PKCS#8 encoded private key,
+// for a KeyStorage to persist. The result is sensitive and must be encrypted at rest.
+func MarshalManagedKey(key ManagedKey) ([]byte, error) {
+	encoded := managedKeyJSON{
+		Kid:         key.JWK.Kid,
+		Algorithm:   key.JWK.Alg(),
+		Secret:      key.JWK.Value,
+		State:       key.State,
+		CreatedAt:   key.CreatedAt,
+		ActivatedAt: key.ActivatedAt,
+		RetiredAt:   key.RetiredAt,
+	}
+
+	if key.JWK.PrivateKey != nil {
+		der, err := x509.MarshalPKCS8PrivateKey(key.JWK.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrJWTKeyInvalid, err)
+		}
+
+		encoded.PrivateKey = der
+	}
+
+	return json.Marshal(encoded)
+}
+
+// UnmarshalManagedKey deserializes a managed key serialized by MarshalManagedKey.
+func UnmarshalManagedKey(data []byte) (ManagedKey, error) {
+	decoded := managedKeyJSON{}
+
+	err := json.Unmarshal(data, &decoded)
+	if err != nil {
+		return ManagedKey{}, fmt.Errorf("%w: %w", ErrJWTKeyInvalid, err)
+	}
+
+	jwk := JWK{
+		Kid:       decoded.Kid,
+		Algorithm: decoded.Algorithm,
+		Value:     decoded.Secret,
+	}
+
+	if len(decoded.PrivateKey) > 0 {
+		jwk.PrivateKey, err = x509.ParsePKCS8PrivateKey(decoded.PrivateKey)
+		if err != nil {
+			return ManagedKey{}, fmt.Errorf("%w: %w", ErrJWTKeyInvalid, err)
+		}
+
+		jwk.PublicKey = jwk.public()
+	}
+
+	// ensures the key material matches the algorithm.
+	_, err = jwk.signingKey()
+	if err != nil {
+		return ManagedKey{}, err
+	}
+
+	return ManagedKey{
+		JWK:         jwk,
+		State:       decoded.State,
+		CreatedAt:   decoded.CreatedAt,
+		ActivatedAt: decoded.ActivatedAt,
+		RetiredAt:   decoded.RetiredAt,
+	}, nil
+}
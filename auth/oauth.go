@@ -95,6 +95,10 @@ func (p *OAuth2Controller) Callback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Reissue the session now that the user is authenticated so that a session
+	// identifier obtained before the login (session fixation) becomes useless.
+	session.Regenerate()
+
 	http.Redirect(w, r, redirectURL, http.StatusSeeOther)
 }
 
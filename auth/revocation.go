@@ -0,0 +1,247 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrJWTRevocationCheckFailure = errors.New("failed to check revocation")
+	ErrJWTRevoked                = errors.New("revoked")
+	ErrJWTRevokeFailure          = errors.New("failed to revoke")
+)
+
+// RevocationStore stores the revoked JWTs.
+//
+// A single JWT is revoked by its jti until it expires.
+// All the JWTs of a subject are revoked by their issue time: the JWTs issued up to the given time are revoked.
+// As the iat claim has a second precision, so has the cutoff: the JWTs issued within the second of the cutoff
+// are revoked too, including those issued right after it. To keep the current JWT, exempt it by its jti.
+// Implementations backed by a database only need to keep the entries until the revoked JWTs expire.
+type RevocationStore interface {
+	// Revoke revokes the JWT with the given jti until it expires.
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+	// RevokeSubject revokes the JWTs of the given subject issued up to the given time, truncated to the second,
+	// except the JWTs with the kept jtis.
+	RevokeSubject(ctx context.Context, subject string, cutoff time.Time, keep ...string) error
+	// IsRevoked returns true if the JWT with the given jti, subject and issue time is revoked.
+	IsRevoked(ctx context.Context, jti string, subject string, issuedAt time.Time) (bool, error)
+}
+
+// WithRevocationStore rejects the parsed JWTs revoked in the given store.
+func WithRevocationStore(store RevocationStore) JWTOption {
+	return func(o *jwtOptions) {
+		o.revocationStore = store
+	}
+}
+
+// WithContext sets the context of the revocation check. Defaults to context.Background().
+func WithContext(ctx context.Context) JWTOption {
+	return func(o *jwtOptions) {
+		o.ctx = ctx
+	}
+}
+
+// RevokeClaims revokes the JWT of the given claims, as returned by ParseJWT.
+func RevokeClaims(ctx context.Context, store RevocationStore, claims Claims) error {
+	mapClaims := jwt.MapClaims(claims)
+
+	jti, ok := claims["jti"].(string)
+	if !ok || jti == "" {
+		return fmt.Errorf("%w: %w: jti", ErrJWTRevokeFailure, ErrJWTClaimMissing)
+	}
+
+	exp, err := mapClaims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return fmt.Errorf("%w: %w: exp", ErrJWTRevokeFailure, ErrJWTClaimMissing)
+	}
+
+	err = store.Revoke(ctx, jti, exp.Time)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrJWTRevokeFailure, err)
+	}
+
+	return nil
+}
+
+// checkRevocation checks that the JWT of the given claims is not revoked in the configured store.
+func (o *jwtOptions) checkRevocation(claims jwt.MapClaims) error {
+	if o.revocationStore == nil {
+		return nil
+	}
+
+	jti, _ := claims["jti"].(string)
+	subject, _ := claims.GetSubject()
+
+	// a JWT without issue time is considered issued before any subject revocation.
+	var issuedAt time.Time
+
+	iat, err := claims.GetIssuedAt()
+	if err == nil && iat != nil {
+		issuedAt = iat.Time
+	}
+
+	revoked, err := o.revocationStore.IsRevoked(o.ctx, jti, subject, issuedAt)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrJWTRevocationCheckFailure, err)
+	}
+
+	if revoked {
+		return fmt.Errorf("%w: %w", ErrJWTInvalid, ErrJWTRevoked)
+	}
+
+	return nil
+}
+
+// subjectRevocation is the revocation of the JWTs of a subject.
+// A zero expiry never expires.
+type subjectRevocation struct {
+	cutoff    time.Time
+	keep      []string
+	expiresAt time.Time
+}
+
+// MemoryRevocationStore is an in-memory revocation store.
+// The entries are kept until the revoked JWTs expire.
+type MemoryRevocationStore struct {
+	maxTTL   time.Duration
+	mu       sync.RWMutex
+	tokens   map[string]time.Time
+	subjects map[string]subjectRevocation
+	done     chan struct{}
+	once     sync.Once
+}
+
+// NewMemoryRevocationStore creates a new memory revocation store.
+// The subject revocations are kept for maxTTL, the longest lifetime of the issued JWTs,
+// or forever if maxTTL is not positive.
+// Expired entries are evicted every cleanupInterval by a background janitor until Close is called.
+func NewMemoryRevocationStore(maxTTL, cleanupInterval time.Duration) *MemoryRevocationStore {
+	s := &MemoryRevocationStore{
+		maxTTL:   maxTTL,
+		tokens:   map[string]time.Time{},
+		subjects: map[string]subjectRevocation{},
+		done:     make(chan struct{}),
+	}
+
+	if cleanupInterval > 0 {
+		go s.janitor(cleanupInterval)
+	}
+
+	return s
+}
+
+// Revoke revokes the JWT with the given jti until it expires.
+func (s *MemoryRevocationStore) Revoke(_ context.Context, jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if expiresAt.After(s.tokens[jti]) {
+		s.tokens[jti] = expiresAt
+	}
+
+	return nil
+}
+
+// RevokeSubject revokes the JWTs of the given subject issued up to the given time, truncated to the second,
+// except the JWTs with the kept jtis.
+func (s *MemoryRevocationStore) RevokeSubject(
+	_ context.Context,
+	subject string,
+	cutoff time.Time,
+	keep ...string,
+) error {
+	// matches the precision of the iat claim.
+	cutoff = cutoff.Truncate(time.Second)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := s.subjects[subject]
+
+	if !cutoff.Before(current.cutoff) {
+		revocation := subjectRevocation{
+			cutoff: cutoff,
+			keep:   slices.Clone(keep),
+		}
+
+		if s.maxTTL > 0 {
+			revocation.expiresAt = cutoff.Add(s.maxTTL)
+		}
+
+		s.subjects[subject] = revocation
+	}
+
+	return nil
+}
+
+// IsRevoked returns true if the JWT with the given jti, subject and issue time is revoked.
+func (s *MemoryRevocationStore) IsRevoked(_ context.Context, jti string, subject string, issuedAt time.Time) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+
+	if expiresAt, ok := s.tokens[jti]; ok && jti != "" && now.Before(expiresAt) {
+		return true, nil
+	}
+
+	if revocation, ok := s.subjects[subject]; ok && subject != "" && revocation.active(now) {
+		return !issuedAt.After(revocation.cutoff) && !slices.Contains(revocation.keep, jti), nil
+	}
+
+	return false, nil
+}
+
+// Close stops the background janitor.
+func (s *MemoryRevocationStore) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+	})
+
+	return nil
+}
+
+// janitor periodically evicts the expired entries.
+func (s *MemoryRevocationStore) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			s.evict(now)
+		}
+	}
+}
+
+// evict removes the entries expired at the given time.
+func (s *MemoryRevocationStore) evict(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for jti, expiresAt := range s.tokens {
+		if !now.Before(expiresAt) {
+			delete(s.tokens, jti)
+		}
+	}
+
+	for subject, revocation := range s.subjects {
+		if !revocation.active(now) {
+			delete(s.subjects, subject)
+		}
+	}
+}
+
+// active returns true if the revocation has not expired at the given time.
+func (r subjectRevocation) active(now time.Time) bool {
+	return r.expiresAt.IsZero() || now.Before(r.expiresAt)
+}
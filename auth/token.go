@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrRefreshTokenInvalid   = errors.New("invalid refresh token")
+	ErrRefreshTokenMissing   = errors.New("missing refresh token")
+	ErrTokenGrantUnsupported = errors.New("unsupported grant type")
+	ErrTokenIssueFailure     = errors.New("failed to issue tokens")
+	ErrTokenRefreshFailure   = errors.New("failed to refresh tokens")
+	ErrTokenRevokeFailure    = errors.New("failed to revoke tokens")
+)
+
+// TokenPair is an access token and its refresh token, encoded as an OAuth2 token response.
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// TokenService issues short-lived JWT access tokens along with opaque refresh tokens.
+//
+// A refresh token is single use: refreshing rotates it within its family, the chain of refresh tokens
+// descending from the same login. Presenting an already rotated refresh token is considered a theft
+// and revokes the whole family, logging out both the legitimate client and the attacker.
+type TokenService struct {
+	keys       func() JWKS
+	store      RefreshTokenStore
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	options    []JWTOption
+}
+
+// NewTokenService creates a new token service signing the access tokens with the active key of keys.
+// The options are applied to the generated access tokens.
+func NewTokenService(
+	keys func() JWKS,
+	store RefreshTokenStore,
+	accessTTL time.Duration,
+	refreshTTL time.Duration,
+	options ...JWTOption,
+) *TokenService {
+	return &TokenService{
+		keys:       keys,
+		store:      store,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+		options:    options,
+	}
+}
+
+// Issue issues a token pair to the given subject, starting a new refresh token family.
+// The custom claims are added to every access token of the family.
+func (s *TokenService) Issue(ctx context.Context, subject string, customClaims Claims) (TokenPair, error) {
+	pair, record, err := s.issue(uuid.NewString(), subject, customClaims)
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("%w: %w", ErrTokenIssueFailure, err)
+	}
+
+	err = s.store.Save(ctx, record)
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("%w: %w", ErrTokenIssueFailure, err)
+	}
+
+	return pair, nil
+}
+
+// Refresh rotates the given refresh token and issues a new token pair.
+// The family is revoked if the refresh token has already been rotated.
+// The refresh token is only rotated once the new pair is issued so that a failure leaves it usable.
+func (s *TokenService) Refresh(ctx context.Context, refreshToken string) (TokenPair, error) {
+	hash := hashRefreshToken(refreshToken)
+
+	record, err := s.store.Get(ctx, hash)
+	if err != nil {
+		return TokenPair{}, s.refreshError(ctx, record, err)
+	}
+
+	pair, next, err := s.issue(record.FamilyID, record.Subject, record.Claims)
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("%w: %w", ErrTokenRefreshFailure, err)
+	}
+
+	// a concurrent refresh may have rotated the refresh token since it was read.
+	record, err = s.store.Rotate(ctx, hash, next)
+	if err != nil {
+		return TokenPair{}, s.refreshError(ctx, record, err)
+	}
+
+	return pair, nil
+}
+
+// Revoke revokes the family of the given refresh token, typically on logout.
+// The access tokens already issued remain valid until they expire.
+func (s *TokenService) Revoke(ctx context.Context, refreshToken string) error {
+	record, err := s.store.Get(ctx, hashRefreshToken(refreshToken))
+	if errors.Is(err, ErrRefreshTokenNotFound) {
+		return nil
+	}
+
+	if err != nil && !errors.Is(err, ErrRefreshTokenReused) {
+		return fmt.Errorf("%w: %w", ErrTokenRevokeFailure, err)
+	}
+
+	err = s.store.RevokeFamily(ctx, record.FamilyID)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrTokenRevokeFailure, err)
+	}
+
+	return nil
+}
+
+// RefreshHandler returns the handler of the refresh endpoint.
+// It expects a POST form with the refresh_token parameter, and an optional grant_type of refresh_token,
+// and responds with the new token pair as JSON.
+func (s *TokenService) RefreshHandler(
+	handleError func(http.ResponseWriter, *http.Request, error),
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		grantType := r.PostFormValue("grant_type")
+		if grantType != "" && grantType != "refresh_token" {
+			handleError(w, r, fmt.Errorf("%w: %s", ErrTokenGrantUnsupported, grantType))
+			return
+		}
+
+		refreshToken := r.PostFormValue("refresh_token")
+		if refreshToken == "" {
+			handleError(w, r, ErrRefreshTokenMissing)
+			return
+		}
+
+		pair, err := s.Refresh(r.Context(), refreshToken)
+		if err != nil {
+			handleError(w, r, err)
+			return
+		}
+
+		// never returns an error as the pair only contains strings and an integer.
+		body, _ := json.Marshal(pair)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+
+		_, _ = w.Write(body)
+	})
+}
+
+// refreshError qualifies a refresh failure, revoking the family of the record on reuse.
+func (s *TokenService) refreshError(ctx context.Context, record RefreshTokenRecord, err error) error {
+	if errors.Is(err, ErrRefreshTokenReused) {
+		err2 := s.store.RevokeFamily(ctx, record.FamilyID)
+		if err2 != nil {
+			return fmt.Errorf("%w: %w", ErrTokenRevokeFailure, err2)
+		}
+
+		return fmt.Errorf("%w: %w", ErrRefreshTokenInvalid, err)
+	}
+
+	if errors.Is(err, ErrRefreshTokenNotFound) {
+		return fmt.Errorf("%w: %w", ErrRefreshTokenInvalid, err)
+	}
+
+	return fmt.Errorf("%w: %w", ErrTokenRefreshFailure, err)
+}
+
+// issue issues a token pair within the given family and returns it with the record of its refresh token, not saved yet.
+func (s *TokenService) issue(familyID, subject string, customClaims Claims) (TokenPair, RefreshTokenRecord, error) {
+	options := append([]JWTOption{}, s.options...)
+	options = append(options, WithSubject(subject))
+
+	accessToken, err := GenerateJWT(s.keys(), customClaims, s.accessTTL, options...)
+	if err != nil {
+		return TokenPair{}, RefreshTokenRecord{}, err
+	}
+
+	refreshToken := generateRefreshToken()
+
+	record := RefreshTokenRecord{
+		Hash:      hashRefreshToken(refreshToken),
+		FamilyID:  familyID,
+		Subject:   subject,
+		Claims:    customClaims,
+		ExpiresAt: time.Now().Add(s.refreshTTL),
+	}
+
+	return TokenPair{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.accessTTL.Seconds()),
+		RefreshToken: refreshToken,
+	}, record, nil
+}
+
+// generateRefreshToken generates an opaque refresh token.
+func generateRefreshToken() string {
+	b := make([]byte, 32)
+
+	// never returns an error.
+	_, _ = rand.Read(b)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// hashRefreshToken returns the stored hash of the refresh token.
+// A fast hash is enough as the refresh tokens are random.
+func hashRefreshToken(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+
+	return hex.EncodeToString(sum[:])
+}
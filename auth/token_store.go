@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"sync"
+	"time"
+)
+
+var (
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrRefreshTokenReused   = errors.New("refresh token reused")
+)
+
+// RefreshTokenRecord is a stored refresh token.
+// The token itself is never stored, only its hash.
+type RefreshTokenRecord struct {
+	Hash      string
+	FamilyID  string
+	Subject   string
+	Claims    Claims
+	ExpiresAt time.Time
+	Used      bool
+}
+
+// RefreshTokenStore stores the refresh tokens.
+//
+// The rotated refresh tokens are kept as used until they expire so that their reuse is detected.
+type RefreshTokenStore interface {
+	// Save saves a new refresh token record.
+	Save(ctx context.Context, record RefreshTokenRecord) error
+	// Get returns the unexpired record with the given hash.
+	// It returns ErrRefreshTokenReused along with the record if it was already used and
+	// ErrRefreshTokenNotFound if there is none.
+	Get(ctx context.Context, hash string) (RefreshTokenRecord, error)
+	// Rotate atomically marks the unexpired record with the given hash as used and saves the next record.
+	// It returns the same errors as Get, in which case the next record is not saved.
+	Rotate(ctx context.Context, hash string, next RefreshTokenRecord) (RefreshTokenRecord, error)
+	// RevokeFamily deletes all the records of the given family.
+	RevokeFamily(ctx context.Context, familyID string) error
+}
+
+// MemoryRefreshTokenStore is an in-memory refresh token store.
+type MemoryRefreshTokenStore struct {
+	mu       sync.Mutex
+	records  map[string]RefreshTokenRecord
+	families map[string]map[string]struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+// NewMemoryRefreshTokenStore creates a new memory refresh token store.
+// Expired records are evicted every cleanupInterval by a background janitor until Close is called.
+func NewMemoryRefreshTokenStore(cleanupInterval time.Duration) *MemoryRefreshTokenStore {
+	s := &MemoryRefreshTokenStore{
+		records:  map[string]RefreshTokenRecord{},
+		families: map[string]map[string]struct{}{},
+		done:     make(chan struct{}),
+	}
+
+	if cleanupInterval > 0 {
+		go s.janitor(cleanupInterval)
+	}
+
+	return s
+}
+
+// Save saves a new refresh token record.
+func (s *MemoryRefreshTokenStore) Save(_ context.Context, record RefreshTokenRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.save(record)
+
+	return nil
+}
+
+// Get returns the unexpired record with the given hash.
+func (s *MemoryRefreshTokenStore) Get(_ context.Context, hash string) (RefreshTokenRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.get(hash)
+}
+
+// Rotate atomically marks the unexpired record with the given hash as used and saves the next record.
+func (s *MemoryRefreshTokenStore) Rotate(
+	_ context.Context,
+	hash string,
+	next RefreshTokenRecord,
+) (RefreshTokenRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, err := s.get(hash)
+	if err != nil {
+		return record, err
+	}
+
+	record.Used = true
+	s.records[hash] = record
+
+	s.save(next)
+
+	return record, nil
+}
+
+// RevokeFamily deletes all the records of the given family.
+func (s *MemoryRefreshTokenStore) RevokeFamily(_ context.Context, familyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash := range s.families[familyID] {
+		delete(s.records, hash)
+	}
+
+	delete(s.families, familyID)
+
+	return nil
+}
+
+// Close stops the background janitor.
+func (s *MemoryRefreshTokenStore) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+	})
+
+	return nil
+}
+
+// get returns the unexpired record with the given hash.
+func (s *MemoryRefreshTokenStore) get(hash string) (RefreshTokenRecord, error) {
+	record, ok := s.records[hash]
+	if !ok || !time.Now().Before(record.ExpiresAt) {
+		return RefreshTokenRecord{}, ErrRefreshTokenNotFound
+	}
+
+	record.Claims = maps.Clone(record.Claims)
+
+	if record.Used {
+		return record, ErrRefreshTokenReused
+	}
+
+	return record, nil
+}
+
+// save saves the record and indexes it by family.
+func (s *MemoryRefreshTokenStore) save(record RefreshTokenRecord) {
+	record.Claims = maps.Clone(record.Claims)
+
+	s.records[record.Hash] = record
+
+	if s.families[record.FamilyID] == nil {
+		s.families[record.FamilyID] = map[string]struct{}{}
+	}
+
+	s.families[record.FamilyID][record.Hash] = struct{}{}
+}
+
+// janitor periodically evicts the expired records.
+func (s *MemoryRefreshTokenStore) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			s.evict(now)
+		}
+	}
+}
+
+// evict removes the records expired at the given time.
+func (s *MemoryRefreshTokenStore) evict(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, record := range s.records {
+		if now.Before(record.ExpiresAt) {
+			continue
+		}
+
+		delete(s.records, hash)
+		delete(s.families[record.FamilyID], hash)
+
+		if len(s.families[record.FamilyID]) == 0 {
+			delete(s.families, record.FamilyID)
+		}
+	}
+}
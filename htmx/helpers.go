@@ -1,11 +1,24 @@
 package htmx
 
-import "net/http"
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/throskam/kix/sess"
+)
+
+// FlashTriggerEvent is the name of the HX-Trigger event carrying the flash messages.
+var FlashTriggerEvent = "flash"
 
 // Redirect redirects the user to the given URL using HTMX headers.
 func Redirect(w http.ResponseWriter, r *http.Request, redirectURL string) {
 	if r.Header.Get("HX-Request") == "true" {
 		if r.Header.Get("HX-Boosted") == "true" {
+			// The page is not reloaded so the flash messages are delivered
+			// with the response instead of waiting for the next page render.
+			TriggerFlashes(w, r)
+
 			w.Header().Add("HX-Location", redirectURL)
 			w.WriteHeader(200)
 			return
@@ -22,3 +35,48 @@ func Redirect(w http.ResponseWriter, r *http.Request, redirectURL string) {
 
 	http.Redirect(w, r, redirectURL, http.StatusSeeOther)
 }
+
+// TriggerFlashes consumes the flash messages of the session and sends them
+// in the HX-Trigger header under the FlashTriggerEvent event.
+// It does nothing if there is no session or no flash message.
+func TriggerFlashes(w http.ResponseWriter, r *http.Request) {
+	if _, err := sess.GetSession(r.Context()); err != nil {
+		return
+	}
+
+	flashes := sess.ConsumeFlashes(r.Context())
+	if len(flashes) == 0 {
+		return
+	}
+
+	events := parseTriggerHeader(w.Header().Get("HX-Trigger"))
+	events[FlashTriggerEvent] = flashes
+
+	// never returns an error as the events are either decoded JSON or flashes.
+	encoded, _ := json.Marshal(events)
+
+	w.Header().Set("HX-Trigger", string(encoded))
+}
+
+// parseTriggerHeader parses an HX-Trigger header value, either a JSON object
+// or a comma separated list of event names.
+func parseTriggerHeader(header string) map[string]any {
+	events := map[string]any{}
+
+	if header == "" {
+		return events
+	}
+
+	if json.Unmarshal([]byte(header), &events) == nil {
+		return events
+	}
+
+	for name := range strings.SplitSeq(header, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			events[name] = nil
+		}
+	}
+
+	return events
+}
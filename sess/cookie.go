@@ -0,0 +1,211 @@
+package sess
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var ErrCookieSessionTooLarge = errors.New("session too large for cookies")
+
+const (
+	// cookieChunkSize is the maximum size of the value of a single session cookie,
+	// leaving room for the name and the attributes within the 4KB browser limit.
+	cookieChunkSize = 3800
+	// cookieMaxChunks is the maximum number of cookies a session can be split across.
+	cookieMaxChunks = 8
+
+	// hostCookiePrefix is the cookie name prefix requiring a secure, host-only cookie on the root path.
+	hostCookiePrefix = "__Host-"
+	// secureCookiePrefix is the cookie name prefix requiring a secure cookie.
+	secureCookiePrefix = "__Secure-"
+
+	// cookieSessionDefaultMaxAge is the validity in seconds of a session kept in the cookie
+	// when the cookie options define a browser session cookie.
+	cookieSessionDefaultMaxAge = 86400 * 30
+)
+
+// CookieOptions holds the attributes of the session cookie.
+//
+// The session cookie is Secure and HttpOnly unless explicitly allowed otherwise,
+// so that any value, including the zero value, is safe.
+// An unset name, path and SameSite mode default to the ones of DefaultCookieOptions.
+type CookieOptions struct {
+	// Name is the name of the cookie. The "__Host-" and "__Secure-" prefixes
+	// are enforced by adjusting the other attributes accordingly.
+	Name     string
+	Domain   string
+	Path     string
+	SameSite http.SameSite
+	// AllowInsecure sends the cookie over plain HTTP, typically for local development.
+	AllowInsecure bool
+	// AllowScriptAccess exposes the cookie to scripts.
+	AllowScriptAccess bool
+	// MaxAge is the lifetime of the cookie in seconds. Zero means a browser session cookie.
+	MaxAge int
+}
+
+// DefaultCookieOptions returns the default session cookie options.
+func DefaultCookieOptions() CookieOptions {
+	return CookieOptions{
+		Name:     "session",
+		Path:     "/",
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// normalize fills the missing name, path and SameSite mode and enforces the requirements of the cookie name prefix.
+func (o CookieOptions) normalize() CookieOptions {
+	if o.Name == "" {
+		o.Name = DefaultCookieOptions().Name
+	}
+
+	if o.Path == "" {
+		o.Path = "/"
+	}
+
+	if o.SameSite == 0 {
+		o.SameSite = http.SameSiteLaxMode
+	}
+
+	if strings.HasPrefix(o.Name, secureCookiePrefix) {
+		o.AllowInsecure = false
+	}
+
+	if strings.HasPrefix(o.Name, hostCookiePrefix) {
+		o.AllowInsecure = false
+		o.Path = "/"
+		o.Domain = ""
+	}
+
+	return o
+}
+
+// sessionMaxAge returns the validity in seconds of a session kept in the cookie,
+// defaulting to 30 days for a browser session cookie as the browser may restore it indefinitely.
+func (o CookieOptions) sessionMaxAge() int {
+	if o.MaxAge > 0 {
+		return o.MaxAge
+	}
+
+	return cookieSessionDefaultMaxAge
+}
+
+// cookie returns the session cookie with the given value.
+func (o CookieOptions) cookie(value string) *http.Cookie {
+	return &http.Cookie{
+		Name:     o.Name,
+		Value:    value,
+		Domain:   o.Domain,
+		Path:     o.Path,
+		SameSite: o.SameSite,
+		Secure:   !o.AllowInsecure,
+		HttpOnly: !o.AllowScriptAccess,
+		MaxAge:   o.MaxAge,
+	}
+}
+
+// expiredCookie returns the session cookie instructing the browser to delete it.
+func (o CookieOptions) expiredCookie() *http.Cookie {
+	cookie := o.cookie("")
+	cookie.MaxAge = -1
+
+	return cookie
+}
+
+// chunkCookieName returns the name of the i-th chunk of the session cookie.
+func (o CookieOptions) chunkCookieName(i int) string {
+	return o.Name + "." + strconv.Itoa(i)
+}
+
+// isChunkCookieName returns true if the name is the one of a chunk of the session cookie.
+func (o CookieOptions) isChunkCookieName(name string) bool {
+	suffix, ok := strings.CutPrefix(name, o.Name+".")
+	if !ok {
+		return false
+	}
+
+	_, err := strconv.Atoi(suffix)
+
+	return err == nil
+}
+
+// readValue returns the value of the session cookie, reassembling it from its chunks if needed.
+// It reports false if the request carries no session cookie.
+func (o CookieOptions) readValue(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(o.Name)
+	if err == nil {
+		return cookie.Value, true
+	}
+
+	var value strings.Builder
+
+	for i := range cookieMaxChunks {
+		cookie, err := r.Cookie(o.chunkCookieName(i))
+		if err != nil {
+			break
+		}
+
+		value.WriteString(cookie.Value)
+	}
+
+	if value.Len() == 0 {
+		return "", false
+	}
+
+	return value.String(), true
+}
+
+// writeValue writes the value of the session cookie, splitting it across
+// numbered chunk cookies when it exceeds the size of a single cookie,
+// and expires the cookies of the request that are no longer used.
+func (o CookieOptions) writeValue(r *http.Request, w http.ResponseWriter, value string) error {
+	if len(value) > cookieChunkSize*cookieMaxChunks {
+		return fmt.Errorf("%w: %d bytes", ErrCookieSessionTooLarge, len(value))
+	}
+
+	written := map[string]bool{}
+
+	if len(value) <= cookieChunkSize {
+		http.SetCookie(w, o.cookie(value))
+		written[o.Name] = true
+	} else {
+		for i := 0; len(value) > 0; i++ {
+			chunk := value[:min(cookieChunkSize, len(value))]
+			value = value[len(chunk):]
+
+			cookie := o.cookie(chunk)
+			cookie.Name = o.chunkCookieName(i)
+
+			http.SetCookie(w, cookie)
+			written[cookie.Name] = true
+		}
+	}
+
+	o.expireCookies(r, w, written)
+
+	return nil
+}
+
+// eraseValue expires the session cookie and all its chunks.
+func (o CookieOptions) eraseValue(r *http.Request, w http.ResponseWriter) {
+	http.SetCookie(w, o.expiredCookie())
+
+	o.expireCookies(r, w, map[string]bool{o.Name: true})
+}
+
+// expireCookies expires the session cookie and its chunks carried by the request, except the kept ones.
+func (o CookieOptions) expireCookies(r *http.Request, w http.ResponseWriter, keep map[string]bool) {
+	for _, cookie := range r.Cookies() {
+		if keep[cookie.Name] || cookie.Name != o.Name && !o.isChunkCookieName(cookie.Name) {
+			continue
+		}
+
+		expired := o.expiredCookie()
+		expired.Name = cookie.Name
+
+		http.SetCookie(w, expired)
+	}
+}
@@ -0,0 +1,68 @@
+package sess
+
+import (
+	"context"
+	"net/url"
+)
+
+// FlashSessionKey is the session key for the flash messages.
+var FlashSessionKey = "flashes"
+
+// FlashLevel is the level of a flash message.
+type FlashLevel string
+
+const (
+	FlashInfo    FlashLevel = "info"
+	FlashSuccess FlashLevel = "success"
+	FlashWarning FlashLevel = "warning"
+	FlashError   FlashLevel = "error"
+)
+
+// Flash is a one-shot message stored in the session until it is consumed.
+type Flash struct {
+	Level   FlashLevel `json:"level"`
+	Message string     `json:"message"`
+}
+
+// AddFlash adds a flash message to the session.
+func AddFlash(ctx context.Context, level FlashLevel, message string) {
+	session := MustGetSession(ctx)
+
+	encoded := url.Values{
+		"level":   {string(level)},
+		"message": {message},
+	}.Encode()
+
+	// the same message may legitimately be flashed twice so duplicates are kept.
+	session.append(FlashSessionKey, encoded)
+}
+
+// PeekFlashes returns the flash messages of the session without consuming them.
+func PeekFlashes(ctx context.Context) []Flash {
+	return decodeFlashes(MustGetSession(ctx).Get(FlashSessionKey))
+}
+
+// ConsumeFlashes returns the flash messages of the session and removes them.
+// Concurrent calls never return the same flash message twice.
+func ConsumeFlashes(ctx context.Context) []Flash {
+	return decodeFlashes(MustGetSession(ctx).take(FlashSessionKey))
+}
+
+// decodeFlashes decodes the flash messages stored in the session.
+func decodeFlashes(encodedFlashes []string) []Flash {
+	flashes := []Flash{}
+
+	for _, encoded := range encodedFlashes {
+		values, err := url.ParseQuery(encoded)
+		if err != nil {
+			continue
+		}
+
+		flashes = append(flashes, Flash{
+			Level:   FlashLevel(values.Get("level")),
+			Message: values.Get("message"),
+		})
+	}
+
+	return flashes
+}
@@ -1,29 +1,175 @@
 package sess
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/throskam/ki"
 )
 
+// DefaultRenewInterval is the default minimum interval between two renewals of an unmodified session.
+const DefaultRenewInterval = time.Minute
+
+// RecoveryPolicy defines which session read failures the Sessionizer middleware recovers from
+// by erasing the session and continuing with a new one.
+type RecoveryPolicy int
+
+const (
+	// RecoverCorrupt recovers from corrupt sessions (ErrSessionCorrupt) and fails on any other error.
+	RecoverCorrupt RecoveryPolicy = iota
+	// RecoverAll recovers from every error except backend failures (ErrSessionBackendFailure).
+	RecoverAll
+	// RecoverNone fails on every error.
+	RecoverNone
+)
+
+// sessionizerOptions holds the configuration of the Sessionizer middleware.
+type sessionizerOptions struct {
+	idleTimeout      time.Duration
+	absoluteLifetime time.Duration
+	renewInterval    time.Duration
+	recoveryPolicy   RecoveryPolicy
+	onRecover        func(*http.Request, error)
+}
+
+// SessionizerOption is a function that configures the Sessionizer middleware.
+type SessionizerOption func(*sessionizerOptions)
+
+// WithIdleTimeout expires the session after the given duration without activity.
+func WithIdleTimeout(timeout time.Duration) SessionizerOption {
+	return func(o *sessionizerOptions) {
+		o.idleTimeout = timeout
+	}
+}
+
+// WithAbsoluteLifetime expires the session after the given duration since its creation, regardless of activity.
+func WithAbsoluteLifetime(lifetime time.Duration) SessionizerOption {
+	return func(o *sessionizerOptions) {
+		o.absoluteLifetime = lifetime
+	}
+}
+
+// WithRenewInterval sets the minimum interval between two writes of an unmodified session
+// to record its activity (sliding expiry). It should be well below the idle timeout.
+func WithRenewInterval(interval time.Duration) SessionizerOption {
+	return func(o *sessionizerOptions) {
+		o.renewInterval = interval
+	}
+}
+
+// WithRecoveryPolicy sets which session read failures are recovered from. Defaults to RecoverCorrupt.
+func WithRecoveryPolicy(policy RecoveryPolicy) SessionizerOption {
+	return func(o *sessionizerOptions) {
+		o.recoveryPolicy = policy
+	}
+}
+
+// WithRecoveryHook sets the function reporting the session read failures that have been recovered from.
+// Defaults to a warning on the default slog logger.
+func WithRecoveryHook(hook func(*http.Request, error)) SessionizerOption {
+	return func(o *sessionizerOptions) {
+		o.onRecover = hook
+	}
+}
+
+// recoverable returns true if the session read failure must be recovered from.
+func (o *sessionizerOptions) recoverable(err error) bool {
+	switch o.recoveryPolicy {
+	case RecoverCorrupt:
+		return errors.Is(err, ErrSessionCorrupt)
+	case RecoverAll:
+		return !errors.Is(err, ErrSessionBackendFailure)
+	default:
+		return false
+	}
+}
+
+// logRecovery reports a recovered session read failure on the default slog logger.
+func logRecovery(r *http.Request, err error) {
+	slog.WarnContext(r.Context(), "recovered from session read failure", slog.Any("error", err))
+}
+
+// expired returns true if the session has exceeded its idle timeout or absolute lifetime at the given time.
+func (o *sessionizerOptions) expired(session *Session, now time.Time) bool {
+	lastSeenAt := session.LastSeenAt()
+	if o.idleTimeout > 0 && !lastSeenAt.IsZero() && now.Sub(lastSeenAt) > o.idleTimeout {
+		return true
+	}
+
+	createdAt := session.CreatedAt()
+	if o.absoluteLifetime > 0 && !createdAt.IsZero() && now.Sub(createdAt) > o.absoluteLifetime {
+		return true
+	}
+
+	return false
+}
+
+// renewalDue returns true if the activity on an unmodified session must be recorded at the given time.
+// A new session is never renewed so that requests that do not use the session do not create one.
+func (o *sessionizerOptions) renewalDue(session *Session, now time.Time) bool {
+	lastSeenAt := session.LastSeenAt()
+	if lastSeenAt.IsZero() {
+		return !session.isNew()
+	}
+
+	return now.Sub(lastSeenAt) >= o.renewInterval
+}
+
 // Sessionizer is a middleware that adds a session to the request context.
+// An expired session is erased and replaced by a new one, as is an unreadable session
+// according to the recovery policy. Backend failures always abort the request.
+// The session is only written back when it has been modified or its activity must be renewed.
 func Sessionizer(
 	store SessionStore,
 	handleError func(http.ResponseWriter, *http.Request, error),
+	options ...SessionizerOption,
 ) func(http.Handler) http.Handler {
+	opts := &sessionizerOptions{
+		renewInterval:  DefaultRenewInterval,
+		recoveryPolicy: RecoverCorrupt,
+		onRecover:      logRecovery,
+	}
+
+	for _, o := range options {
+		o(opts)
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			session, err := store.Read(r)
 			if err != nil {
-				err2 := store.Erase(r, w)
-				if err2 != nil {
-					handleError(w, r, fmt.Errorf("%w: %w", ErrSessionEraseFailure, err2))
+				// the stored session is unreachable rather than invalid so it must be kept.
+				if !errors.Is(err, ErrSessionBackendFailure) {
+					err2 := store.Erase(r, w)
+					if err2 != nil {
+						handleError(w, r, fmt.Errorf("%w: %w", ErrSessionEraseFailure, err2))
+						return
+					}
+				}
+
+				if !opts.recoverable(err) {
+					handleError(w, r, fmt.Errorf("%w: %w", ErrSessionReadFailure, err))
 					return
 				}
 
-				handleError(w, r, fmt.Errorf("%w: %w", ErrSessionReadFailure, err))
-				return
+				opts.onRecover(r, err)
+
+				session = NewSession()
+			}
+
+			now := time.Now()
+
+			if opts.expired(session, now) {
+				err = store.Erase(r, w)
+				if err != nil {
+					handleError(w, r, fmt.Errorf("%w: %w", ErrSessionEraseFailure, err))
+					return
+				}
+
+				session = NewSession()
 			}
 
 			ctx := setSession(r.Context(), session)
@@ -32,10 +178,22 @@ func Sessionizer(
 
 			next.ServeHTTP(brw, r.WithContext(ctx))
 
-			err = store.Write(r, brw, session)
-			if err != nil {
-				handleError(w, r, fmt.Errorf("%w: %w", ErrSessionWriteFailure, err))
-				return
+			modified := session.Modified()
+
+			if modified || opts.renewalDue(session, now) {
+				session.touch(now)
+
+				err = store.Write(r, brw, session)
+
+				// a concurrent request already wrote the session so there is nothing to lose.
+				if !modified && errors.Is(err, ErrSessionVersionConflict) {
+					err = nil
+				}
+
+				if err != nil {
+					handleError(w, r, fmt.Errorf("%w: %w", ErrSessionWriteFailure, err))
+					return
+				}
 			}
 
 			_, err = brw.Flush()
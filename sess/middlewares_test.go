@@ -0,0 +1,103 @@
+package sess
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSessionizerRenewalDoesNotConflictWithModification(t *testing.T) {
+	fileBackend, err := NewFileSessionBackend(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backends := map[string]SessionBackend{
+		"memory": NewMemorySessionBackend(0),
+		"file":   fileBackend,
+	}
+
+	for name, backend := range backends {
+		t.Run(name, func(t *testing.T) {
+			store := NewServerSessionStore(backend, time.Hour, DefaultCookieOptions())
+
+			// a session whose renewal is due.
+			seed := NewSession()
+			seed.Reset("key", "initial")
+			seed.touch(time.Now().Add(-time.Hour))
+
+			rec := httptest.NewRecorder()
+
+			err := store.Write(httptest.NewRequest(http.MethodGet, "/", nil), rec, seed)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cookie := rec.Result().Cookies()[0]
+
+			handleError := func(w http.ResponseWriter, _ *http.Request, err error) {
+				t.Errorf("unexpected error: %v", err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+
+			sessionizer := Sessionizer(store, handleError)
+
+			readOnly := sessionizer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+			read := make(chan struct{})
+			renewed := make(chan struct{})
+
+			modifying := sessionizer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				close(read)
+				<-renewed
+
+				MustGetSession(r.Context()).Reset("key", "modified")
+			}))
+
+			request := func() *http.Request {
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				r.AddCookie(cookie)
+
+				return r
+			}
+
+			// B reads the session, A renews it, then B writes its modification.
+			recB := httptest.NewRecorder()
+			done := make(chan struct{})
+
+			go func() {
+				defer close(done)
+				modifying.ServeHTTP(recB, request())
+			}()
+
+			<-read
+
+			recA := httptest.NewRecorder()
+			readOnly.ServeHTTP(recA, request())
+
+			close(renewed)
+			<-done
+
+			if recA.Code != http.StatusOK || recB.Code != http.StatusOK {
+				t.Fatalf("got statuses %d and %d, want %d", recA.Code, recB.Code, http.StatusOK)
+			}
+
+			record, err := backend.Load(context.Background(), cookie.Value)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			values, err := url.ParseQuery(string(record.Data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := values.Get("key"); got != "modified" {
+				t.Errorf("got %q, want %q", got, "modified")
+			}
+		})
+	}
+}
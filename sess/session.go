@@ -5,10 +5,17 @@ import (
 	"net/http"
 	"net/url"
 	"slices"
+	"strconv"
+	"sync"
+	"time"
 )
 
-// SessionCookieKey is the name of the session cookie.
-var SessionCookieKey = "session"
+// Reserved session keys used to track the lifetime and the owner of the session.
+const (
+	sessionCreatedAtKey  = "_created_at"
+	sessionLastSeenAtKey = "_last_seen_at"
+	sessionUserIDKey     = "_user_id"
+)
 
 var (
 	ErrSessionEraseFailure = errors.New("failed to erase session")
@@ -16,6 +23,14 @@ var (
 	ErrSessionWriteFailure = errors.New("failed to write session")
 )
 
+// Errors wrapped by the session stores to qualify their failures.
+var (
+	// ErrSessionCorrupt reports a session that cannot be decoded, such as a tampered or stale cookie.
+	ErrSessionCorrupt = errors.New("corrupt session")
+	// ErrSessionBackendFailure reports a session storage that cannot be reached.
+	ErrSessionBackendFailure = errors.New("session backend failure")
+)
+
 // SessionStore is the interface for session stores.
 type SessionStore interface {
 	Read(*http.Request) (*Session, error)
@@ -24,8 +39,15 @@ type SessionStore interface {
 }
 
 // Session is a session.
+// It is safe for concurrent use: accessors return copies and mutations are serialized.
 type Session struct {
-	values url.Values
+	mu         sync.RWMutex
+	id         string
+	version    int64
+	values     url.Values
+	regenerate bool
+	modified   bool
+	renewal    bool
 }
 
 // NewSession creates a new session.
@@ -35,52 +57,185 @@ func NewSession() *Session {
 	}
 }
 
+// ID returns the identifier of the session.
+// It is only set by server-side stores and is empty until the session has been written.
+func (s *Session) ID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.id
+}
+
+// Regenerate marks the session to be reissued under a new identity on the next write.
+// Stores migrate the values and invalidate the previous session, which prevents session fixation
+// when called on privilege changes such as a login.
+func (s *Session) Regenerate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.regenerate = true
+	s.modified = true
+}
+
+// Modified returns true if the session has changed since it was read.
+func (s *Session) Modified() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.modified
+}
+
 // Get returns the values of the session for the given key.
 func (s *Session) Get(key string) []string {
-	return s.values[key]
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return slices.Clone(s.values[key])
 }
 
 // GetFirst returns the first value of the session for the given key.
 func (s *Session) GetFirst(key string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	return s.values.Get(key)
 }
 
 // Empty returns true if the session does not contain the given key.
 func (s *Session) Empty(key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	return !s.values.Has(key)
 }
 
 // Has returns true if the session contains the given key and value.
 func (s *Session) Has(key, value string) bool {
-	if s.Empty(key) {
-		return false
-	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	return slices.Contains(s.values[key], value)
+	return s.has(key, value)
 }
 
 // Set sets the values of the session for the given key.
 func (s *Session) Set(key string, values []string) {
-	s.values[key] = values
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.values[key] = slices.Clone(values)
+	s.modified = true
 }
 
 // Reset sets the value of the session for the given key.
 func (s *Session) Reset(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	s.values.Set(key, value)
+	s.modified = true
 }
 
 // Add adds the value to the session for the given key.
 func (s *Session) Add(key, value string) {
-	if s.Has(key, value) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.add(key, value)
+}
+
+// Remove removes the value from the session for the given key.
+func (s *Session) Remove(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(key, value)
+}
+
+// Toggle toggles the value of the session for the given key.
+func (s *Session) Toggle(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.has(key, value) {
+		s.remove(key, value)
+	} else {
+		s.add(key, value)
+	}
+}
+
+// Del deletes the session for the given key.
+func (s *Session) Del(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.values.Has(key) {
+		return
+	}
+
+	s.values.Del(key)
+	s.modified = true
+}
+
+// CreatedAt returns the time the session was first written or the zero time for a new session.
+func (s *Session) CreatedAt() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.getTime(sessionCreatedAtKey)
+}
+
+// LastSeenAt returns the time of the last activity on the session or the zero time for a new session.
+func (s *Session) LastSeenAt() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.getTime(sessionLastSeenAtKey)
+}
+
+// UserID returns the identifier of the user owning the session or an empty string for an anonymous session.
+func (s *Session) UserID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.values.Get(sessionUserIDKey)
+}
+
+// SetUserID sets the identifier of the user owning the session.
+// Server-side stores index the sessions by user so that they can be listed and revoked.
+func (s *Session) SetUserID(userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if userID == "" {
+		s.values.Del(sessionUserIDKey)
+	} else {
+		s.values.Set(sessionUserIDKey, userID)
+	}
+
+	s.modified = true
+}
+
+// has returns true if the session contains the given key and value.
+// The caller must hold the lock.
+func (s *Session) has(key, value string) bool {
+	return slices.Contains(s.values[key], value)
+}
+
+// add adds the value for the given key if it is not already present.
+// The caller must hold the lock.
+func (s *Session) add(key, value string) {
+	if s.has(key, value) {
 		return
 	}
 
 	s.values.Add(key, value)
+	s.modified = true
 }
 
-// Remove removes the value from the session for the given key.
-func (s *Session) Remove(key, value string) {
-	if !s.Has(key, value) {
+// remove removes the value for the given key.
+// The caller must hold the lock.
+func (s *Session) remove(key, value string) {
+	if !s.has(key, value) {
 		return
 	}
 
@@ -92,19 +247,111 @@ func (s *Session) Remove(key, value string) {
 		}
 	}
 
-	s.Set(key, values)
+	s.values[key] = values
+	s.modified = true
 }
 
-// Toggle toggles the value of the session for the given key.
-func (s *Session) Toggle(key, value string) {
-	if s.Has(key, value) {
-		s.Remove(key, value)
-	} else {
-		s.Add(key, value)
+// append adds the value for the given key, even if it is already present.
+func (s *Session) append(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.values.Add(key, value)
+	s.modified = true
+}
+
+// take returns the values for the given key and deletes them atomically.
+func (s *Session) take(key string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	values := s.values[key]
+	if values == nil {
+		return nil
 	}
+
+	delete(s.values, key)
+	s.modified = true
+
+	return values
 }
 
-// Del deletes the session for the given key.
-func (s *Session) Del(key string) {
-	s.values.Del(key)
+// snapshot returns a copy of the session state for the stores to persist.
+func (s *Session) snapshot() (id string, version int64, values url.Values, regenerate bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	values = make(url.Values, len(s.values))
+
+	for k, v := range s.values {
+		values[k] = slices.Clone(v)
+	}
+
+	return s.id, s.version, values, s.regenerate
+}
+
+// written records that the session has been persisted under the given ID and version.
+func (s *Session) written(id string, version int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.id = id
+	s.version = version
+	s.regenerate = false
+	s.modified = false
+	s.renewal = false
+}
+
+// isNew returns true if the session has never been written.
+func (s *Session) isNew() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.id == "" && len(s.values) == 0
+}
+
+// isRenewal returns true if the pending write only records the activity on the session.
+func (s *Session) isRenewal() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.renewal
+}
+
+// touch records an activity on the session at the given time.
+// On an unmodified session, the next write is a renewal that only records this activity.
+func (s *Session) touch(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.renewal = !s.modified
+
+	if s.getTime(sessionCreatedAtKey).IsZero() {
+		s.setTime(sessionCreatedAtKey, now)
+	}
+
+	s.setTime(sessionLastSeenAtKey, now)
+	s.modified = true
+}
+
+// getTime returns the time stored for the given key or the zero time.
+// The caller must hold the lock.
+func (s *Session) getTime(key string) time.Time {
+	return parseSessionTime(s.values, key)
+}
+
+// setTime stores the time for the given key.
+// The caller must hold the lock.
+func (s *Session) setTime(key string, t time.Time) {
+	s.values.Set(key, strconv.FormatInt(t.Unix(), 10))
+}
+
+// parseSessionTime returns the time stored in the values for the given key or the zero time.
+func parseSessionTime(values url.Values, key string) time.Time {
+	unix, err := strconv.ParseInt(values.Get(key), 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.Unix(unix, 0)
 }
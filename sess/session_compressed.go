@@ -0,0 +1,225 @@
+package sess
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrCompressedSessionReadFailure  = errors.New("failed to read compressed session")
+	ErrCompressedSessionWriteFailure = errors.New("failed to write compressed session")
+)
+
+// UncompressedSessionKeyPrefix is the prefix of the session keys never compressed by CompressedSessionStore,
+// which includes the session metadata.
+const UncompressedSessionKeyPrefix = "_"
+
+const (
+	// compressedSessionKey is the session key under which the compressed values are stored in the underlying store.
+	compressedSessionKey = "_z"
+	// compressedSessionMaxSize is the maximum size of the decompressed values.
+	compressedSessionMaxSize = 1 << 20
+)
+
+// Versions of the compressed session format.
+const (
+	compressedSessionRaw   byte = 0
+	compressedSessionFlate byte = 1
+)
+
+// compressedSessionOptions holds the configuration of the CompressedSessionStore.
+type compressedSessionOptions struct {
+	uncompressedKeys []string
+}
+
+// CompressedSessionOption configures the CompressedSessionStore.
+type CompressedSessionOption func(*compressedSessionOptions)
+
+// WithUncompressedKeys leaves the values of the given keys out of the compressed data.
+func WithUncompressedKeys(keys ...string) CompressedSessionOption {
+	return func(o *compressedSessionOptions) {
+		o.uncompressedKeys = append(o.uncompressedKeys, keys...)
+	}
+}
+
+// CompressedSessionStore is a session store decorator that compresses the session values
+// before handing them to the underlying store.
+// Sessions written by the underlying store without compression are still read as is.
+//
+// Compressing secrets along with attacker-influenced values, such as return URLs or form drafts,
+// leaks the secrets through the size of the cookie, even encrypted (CRIME-style attack).
+// The keys starting with UncompressedSessionKeyPrefix, including the session metadata,
+// and the keys given to WithUncompressedKeys are therefore left uncompressed: keep the secrets,
+// such as CSRF tokens, under such keys.
+//
+//	store := sess.NewCompressedSessionStore(inner, sess.WithUncompressedKeys(auth.CSRFTokenKey, auth.OAuthCSRFTokenKey))
+type CompressedSessionStore struct {
+	store            SessionStore
+	uncompressedKeys []string
+}
+
+// NewCompressedSessionStore creates a new compressed session store wrapping the given store.
+func NewCompressedSessionStore(store SessionStore, options ...CompressedSessionOption) *CompressedSessionStore {
+	opts := &compressedSessionOptions{}
+
+	for _, option := range options {
+		option(opts)
+	}
+
+	return &CompressedSessionStore{
+		store:            store,
+		uncompressedKeys: opts.uncompressedKeys,
+	}
+}
+
+// Read reads the session from the underlying store and decompresses it.
+func (s *CompressedSessionStore) Read(r *http.Request) (*Session, error) {
+	inner, err := s.store.Read(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if inner.Empty(compressedSessionKey) {
+		return inner, nil
+	}
+
+	values, err := decompressSessionValues(inner.GetFirst(compressedSessionKey))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w: %v", ErrCompressedSessionReadFailure, ErrSessionCorrupt, err)
+	}
+
+	// the uncompressed values are the other values of the underlying session.
+	for key, v := range inner.values {
+		if key != compressedSessionKey {
+			values[key] = v
+		}
+	}
+
+	session := NewSession()
+	session.id = inner.id
+	session.version = inner.version
+	session.values = values
+	session.modified = inner.modified
+
+	return session, nil
+}
+
+// Write compresses the session and writes it to the underlying store.
+func (s *CompressedSessionStore) Write(r *http.Request, w http.ResponseWriter, session *Session) error {
+	id, version, values, regenerate := session.snapshot()
+
+	inner := NewSession()
+	inner.id = id
+	inner.version = version
+	inner.regenerate = regenerate
+	inner.renewal = session.isRenewal()
+
+	for key, v := range values {
+		if s.uncompressed(key) {
+			inner.values[key] = v
+			delete(values, key)
+		}
+	}
+
+	compressed, err := compressSessionValues(values)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCompressedSessionWriteFailure, err)
+	}
+
+	inner.values.Set(compressedSessionKey, compressed)
+
+	err = s.store.Write(r, w, inner)
+	if err != nil {
+		return err
+	}
+
+	session.written(inner.id, inner.version)
+
+	return nil
+}
+
+// Erase erases the session from the underlying store.
+func (s *CompressedSessionStore) Erase(r *http.Request, w http.ResponseWriter) error {
+	return s.store.Erase(r, w)
+}
+
+// uncompressed returns true if the values of the given key must be left out of the compressed data.
+func (s *CompressedSessionStore) uncompressed(key string) bool {
+	return strings.HasPrefix(key, UncompressedSessionKeyPrefix) || slices.Contains(s.uncompressedKeys, key)
+}
+
+// compressSessionValues encodes the values with a leading version byte,
+// compressed unless compression does not reduce their size.
+func compressSessionValues(values url.Values) (string, error) {
+	encoded := []byte(values.Encode())
+
+	var buf bytes.Buffer
+
+	buf.WriteByte(compressedSessionFlate)
+
+	fw, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = fw.Write(encoded)
+	if err != nil {
+		return "", err
+	}
+
+	err = fw.Close()
+	if err != nil {
+		return "", err
+	}
+
+	data := buf.Bytes()
+
+	if len(data) > len(encoded)+1 {
+		data = append([]byte{compressedSessionRaw}, encoded...)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decompressSessionValues decodes the values encoded by compressSessionValues.
+func decompressSessionValues(compressed string) (url.Values, error) {
+	data, err := base64.RawURLEncoding.DecodeString(compressed)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return nil, errors.New("missing version")
+	}
+
+	var encoded []byte
+
+	switch data[0] {
+	case compressedSessionRaw:
+		encoded = data[1:]
+	case compressedSessionFlate:
+		fr := flate.NewReader(bytes.NewReader(data[1:]))
+		defer fr.Close()
+
+		encoded, err = io.ReadAll(io.LimitReader(fr, compressedSessionMaxSize+1))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(encoded) > compressedSessionMaxSize {
+			return nil, errors.New("decompressed session too large")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported version %d", data[0])
+	}
+
+	return url.ParseQuery(string(encoded))
+}
@@ -8,31 +8,38 @@ import (
 	"net/url"
 )
 
-var ErrCookieSessionReadFailure = errors.New("failed to read cookie session")
+var (
+	ErrCookieSessionReadFailure  = errors.New("failed to read cookie session")
+	ErrCookieSessionWriteFailure = errors.New("failed to write cookie session")
+)
 
 // CookieSessionStore is a session store that uses cookies.
-type CookieSessionStore struct{}
+type CookieSessionStore struct {
+	options CookieOptions
+}
 
 // NewCookieSessionStore creates a new cookie session store.
-func NewCookieSessionStore() *CookieSessionStore {
-	return &CookieSessionStore{}
+func NewCookieSessionStore(options CookieOptions) *CookieSessionStore {
+	return &CookieSessionStore{
+		options: options.normalize(),
+	}
 }
 
 // Read reads the session from the request.
 func (s *CookieSessionStore) Read(r *http.Request) (*Session, error) {
-	cookie, err := r.Cookie(SessionCookieKey)
-	if err != nil {
+	value, ok := s.options.readValue(r)
+	if !ok {
 		return NewSession(), nil
 	}
 
-	data, err := base64.StdEncoding.DecodeString(cookie.Value)
+	data, err := base64.StdEncoding.DecodeString(value)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrCookieSessionReadFailure, err)
+		return nil, fmt.Errorf("%w: %w: %v", ErrCookieSessionReadFailure, ErrSessionCorrupt, err)
 	}
 
 	values, err := url.ParseQuery(string(data))
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrCookieSessionReadFailure, err)
+		return nil, fmt.Errorf("%w: %w: %v", ErrCookieSessionReadFailure, ErrSessionCorrupt, err)
 	}
 
 	session := NewSession()
@@ -43,27 +50,24 @@ func (s *CookieSessionStore) Read(r *http.Request) (*Session, error) {
 
 // Write writes the session to the response.
 func (s *CookieSessionStore) Write(r *http.Request, w http.ResponseWriter, session *Session) error {
-	encoded := base64.StdEncoding.EncodeToString([]byte(session.values.Encode()))
+	_, _, values, _ := session.snapshot()
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(values.Encode()))
+
+	err := s.options.writeValue(r, w, encoded)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCookieSessionWriteFailure, err)
+	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     SessionCookieKey,
-		Value:    encoded,
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   true,
-	})
+	// the cookie carries the whole session so a new cookie is a new session.
+	session.written("", 0)
 
 	return nil
 }
 
 // Erase erases the session from the response.
 func (s *CookieSessionStore) Erase(r *http.Request, w http.ResponseWriter) error {
-	http.SetCookie(w, &http.Cookie{
-		Name:   SessionCookieKey,
-		Value:  "",
-		Path:   "/",
-		MaxAge: -1,
-	})
+	s.options.eraseValue(r, w)
 
 	return nil
 }
@@ -0,0 +1,172 @@
+package sess
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var (
+	ErrEncryptedCookieSessionKeyInvalid   = errors.New("invalid encrypted cookie session key")
+	ErrEncryptedCookieSessionKeyMissing   = errors.New("missing encrypted cookie session key")
+	ErrEncryptedCookieSessionReadFailure  = errors.New("failed to read encrypted cookie session")
+	ErrEncryptedCookieSessionWriteFailure = errors.New("failed to write encrypted cookie session")
+)
+
+const (
+	// encryptedCookieVersion is the version of the encrypted cookie format.
+	encryptedCookieVersion byte = 1
+	// encryptedCookieTimestampSize is the size of the issue timestamp prefixed to the plaintext.
+	encryptedCookieTimestampSize = 8
+)
+
+// EncryptedCookieSessionStore is a session store that keeps the session in a cookie
+// encrypted and authenticated with AES-GCM.
+type EncryptedCookieSessionStore struct {
+	options CookieOptions
+	aeads   []cipher.AEAD
+}
+
+// NewEncryptedCookieSessionStore creates a new encrypted cookie session store.
+// Each key must be 16, 24 or 32 bytes long. The first key encrypts, all of them decrypt,
+// and sessions decrypted with an older key are re-encrypted with the first one.
+func NewEncryptedCookieSessionStore(options CookieOptions, keys ...[]byte) (*EncryptedCookieSessionStore, error) {
+	if len(keys) == 0 {
+		return nil, ErrEncryptedCookieSessionKeyMissing
+	}
+
+	aeads := make([]cipher.AEAD, 0, len(keys))
+
+	for _, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrEncryptedCookieSessionKeyInvalid, err)
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrEncryptedCookieSessionKeyInvalid, err)
+		}
+
+		aeads = append(aeads, aead)
+	}
+
+	return &EncryptedCookieSessionStore{
+		options: options.normalize(),
+		aeads:   aeads,
+	}, nil
+}
+
+// Read reads the session from the request.
+// A session issued longer than the cookie MaxAge ago, or 30 days for a browser session cookie, is discarded.
+func (s *EncryptedCookieSessionStore) Read(r *http.Request) (*Session, error) {
+	value, ok := s.options.readValue(r)
+	if !ok {
+		return NewSession(), nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w: %v", ErrEncryptedCookieSessionReadFailure, ErrSessionCorrupt, err)
+	}
+
+	plaintext, rotated, err := s.decrypt(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w: %v", ErrEncryptedCookieSessionReadFailure, ErrSessionCorrupt, err)
+	}
+
+	issuedAt := time.Unix(int64(binary.BigEndian.Uint64(plaintext)), 0)
+	if time.Since(issuedAt) > time.Duration(s.options.sessionMaxAge())*time.Second {
+		return NewSession(), nil
+	}
+
+	values, err := url.ParseQuery(string(plaintext[encryptedCookieTimestampSize:]))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w: %v", ErrEncryptedCookieSessionReadFailure, ErrSessionCorrupt, err)
+	}
+
+	session := NewSession()
+	session.values = values
+
+	// force a write so that the session gets re-encrypted with the newest key.
+	session.modified = rotated
+
+	return session, nil
+}
+
+// Write writes the session to the response.
+func (s *EncryptedCookieSessionStore) Write(r *http.Request, w http.ResponseWriter, session *Session) error {
+	_, _, values, _ := session.snapshot()
+
+	encoded := values.Encode()
+
+	plaintext := make([]byte, encryptedCookieTimestampSize, encryptedCookieTimestampSize+len(encoded))
+	binary.BigEndian.PutUint64(plaintext, uint64(time.Now().Unix()))
+	plaintext = append(plaintext, encoded...)
+
+	err := s.options.writeValue(r, w, base64.RawURLEncoding.EncodeToString(s.encrypt(plaintext)))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrEncryptedCookieSessionWriteFailure, err)
+	}
+
+	// the cookie carries the whole session so a new cookie is a new session.
+	session.written("", 0)
+
+	return nil
+}
+
+// Erase erases the session from the response.
+func (s *EncryptedCookieSessionStore) Erase(r *http.Request, w http.ResponseWriter) error {
+	s.options.eraseValue(r, w)
+
+	return nil
+}
+
+// encrypt encrypts the plaintext with the first key.
+// The cookie name is authenticated so that a value cannot be replayed under another cookie.
+func (s *EncryptedCookieSessionStore) encrypt(plaintext []byte) []byte {
+	aead := s.aeads[0]
+
+	nonce := make([]byte, aead.NonceSize())
+
+	// never returns an error.
+	_, _ = rand.Read(nonce)
+
+	data := append([]byte{encryptedCookieVersion}, nonce...)
+
+	return aead.Seal(data, nonce, plaintext, []byte(s.options.Name))
+}
+
+// decrypt decrypts the data with the first key that authenticates it
+// and reports whether it was not the first key.
+func (s *EncryptedCookieSessionStore) decrypt(data []byte) ([]byte, bool, error) {
+	if len(data) == 0 || data[0] != encryptedCookieVersion {
+		return nil, false, errors.New("unsupported format")
+	}
+
+	data = data[1:]
+
+	for i, aead := range s.aeads {
+		if len(data) < aead.NonceSize() {
+			continue
+		}
+
+		nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+
+		plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(s.options.Name))
+		if err != nil || len(plaintext) < encryptedCookieTimestampSize {
+			continue
+		}
+
+		return plaintext, i > 0, nil
+	}
+
+	return nil, false, errors.New("no key could decrypt the session")
+}
@@ -0,0 +1,374 @@
+package sess
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrFileSessionLockTimeout = errors.New("timed out waiting for file session lock")
+	ErrFileSessionCorrupted   = errors.New("corrupted file session")
+)
+
+const (
+	// fileSessionExt is the extension of the session files.
+	fileSessionExt = ".session"
+	// fileSessionLockExt is the extension of the session lock files.
+	fileSessionLockExt = ".lock"
+	// fileSessionLockCount is the number of in-process locks of the file session backend.
+	fileSessionLockCount = 64
+	// fileSessionLockTimeout is how long to wait for a session lock file.
+	fileSessionLockTimeout = 5 * time.Second
+	// fileSessionLockStale is the age after which a session lock file is considered abandoned.
+	fileSessionLockStale = 30 * time.Second
+	// fileSessionHeaderSize is the size of the expiry and version header of the session files.
+	fileSessionHeaderSize = 16
+)
+
+// FileSessionStore is a server-side session store that persists sessions as files.
+type FileSessionStore struct {
+	*ServerSessionStore
+	backend *FileSessionBackend
+}
+
+// NewFileSessionStore creates a new file session store in the given directory.
+// Expired session files are garbage collected every gcInterval until Close is called.
+func NewFileSessionStore(
+	dir string,
+	ttl time.Duration,
+	gcInterval time.Duration,
+	options CookieOptions,
+) (*FileSessionStore, error) {
+	backend, err := NewFileSessionBackend(dir, gcInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileSessionStore{
+		ServerSessionStore: NewServerSessionStore(backend, ttl, options),
+		backend:            backend,
+	}, nil
+}
+
+// Close stops the background garbage collection.
+func (s *FileSessionStore) Close() error {
+	return s.backend.Close()
+}
+
+// FileSessionBackend is a session backend that stores each session in its own file.
+type FileSessionBackend struct {
+	dir   string
+	locks [fileSessionLockCount]sync.Mutex
+	done  chan struct{}
+	once  sync.Once
+}
+
+// NewFileSessionBackend creates a new file session backend in the given directory.
+// Expired session files are garbage collected every gcInterval until Close is called.
+func NewFileSessionBackend(dir string, gcInterval time.Duration) (*FileSessionBackend, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session directory: %w", err)
+	}
+
+	b := &FileSessionBackend{
+		dir:  dir,
+		done: make(chan struct{}),
+	}
+
+	if gcInterval > 0 {
+		go b.gc(gcInterval)
+	}
+
+	return b, nil
+}
+
+// Load loads the session record with the given ID.
+func (b *FileSessionBackend) Load(_ context.Context, id string) (SessionRecord, error) {
+	if !isValidSessionID(id) {
+		return SessionRecord{}, ErrSessionNotFound
+	}
+
+	data, err := os.ReadFile(b.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return SessionRecord{}, ErrSessionNotFound
+	}
+
+	if err != nil {
+		return SessionRecord{}, err
+	}
+
+	record, err := decodeFileSession(data)
+	if err != nil {
+		return SessionRecord{}, fmt.Errorf("%w: %w", ErrSessionCorrupt, err)
+	}
+
+	if !time.Now().Before(record.ExpiresAt) {
+		return SessionRecord{}, ErrSessionNotFound
+	}
+
+	return record, nil
+}
+
+// Save atomically saves the session record with the given ID if its version matches the stored one.
+func (b *FileSessionBackend) Save(ctx context.Context, id string, record SessionRecord) error {
+	return b.save(ctx, id, record, false)
+}
+
+// Touch atomically saves the session record with the given ID if its version matches the stored one,
+// keeping that version.
+func (b *FileSessionBackend) Touch(ctx context.Context, id string, record SessionRecord) error {
+	return b.save(ctx, id, record, true)
+}
+
+// Delete deletes the session record with the given ID.
+func (b *FileSessionBackend) Delete(_ context.Context, id string) error {
+	if !isValidSessionID(id) {
+		return nil
+	}
+
+	unlock, err := b.lock(id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = os.Remove(b.path(id))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// Close stops the background garbage collection.
+func (b *FileSessionBackend) Close() error {
+	b.once.Do(func() {
+		close(b.done)
+	})
+
+	return nil
+}
+
+// save atomically saves the session record with the given ID if its version matches the stored one.
+// A touch keeps the stored version and never creates a session.
+func (b *FileSessionBackend) save(ctx context.Context, id string, record SessionRecord, touch bool) error {
+	if !isValidSessionID(id) {
+		return ErrSessionNotFound
+	}
+
+	unlock, err := b.lock(id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	var version int64
+
+	current, err := b.Load(ctx, id)
+	if err == nil {
+		version = current.Version
+	} else if !errors.Is(err, ErrSessionNotFound) {
+		return err
+	}
+
+	if record.Version != version || touch && version == 0 {
+		return ErrSessionVersionConflict
+	}
+
+	if !touch {
+		record.Version++
+	}
+
+	tmp, err := os.CreateTemp(b.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	// no-op once the file has been renamed.
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	_, err = tmp.Write(encodeFileSession(record))
+	if err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	err = tmp.Sync()
+	if err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), b.path(id))
+}
+
+// path returns the path of the session file for the given ID.
+func (b *FileSessionBackend) path(id string) string {
+	return filepath.Join(b.dir, id+fileSessionExt)
+}
+
+// lock acquires the lock of the session with the given ID.
+// The lock is held both in-process and through a lock file for other processes sharing the directory.
+func (b *FileSessionBackend) lock(id string) (func(), error) {
+	h := fnv.New32a()
+
+	// never returns an error.
+	_, _ = h.Write([]byte(id))
+
+	mu := &b.locks[h.Sum32()%fileSessionLockCount]
+	mu.Lock()
+
+	lockPath := filepath.Join(b.dir, id+fileSessionLockExt)
+	deadline := time.Now().Add(fileSessionLockTimeout)
+
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			_ = f.Close()
+
+			return func() {
+				_ = os.Remove(lockPath)
+				mu.Unlock()
+			}, nil
+		}
+
+		if !errors.Is(err, fs.ErrExist) {
+			mu.Unlock()
+			return nil, err
+		}
+
+		info, err := os.Stat(lockPath)
+		if err == nil && time.Since(info.ModTime()) > fileSessionLockStale {
+			_ = os.Remove(lockPath)
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			mu.Unlock()
+			return nil, ErrFileSessionLockTimeout
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// gc periodically removes the expired session files.
+func (b *FileSessionBackend) gc(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.done:
+			return
+		case now := <-ticker.C:
+			b.collect(now)
+		}
+	}
+}
+
+// collect removes the session files expired at the given time.
+func (b *FileSessionBackend) collect(now time.Time) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), fileSessionExt)
+		if !ok || entry.IsDir() {
+			continue
+		}
+
+		expiresAt, err := b.readExpiry(id)
+		if err != nil || now.Before(expiresAt) {
+			continue
+		}
+
+		unlock, err := b.lock(id)
+		if err != nil {
+			continue
+		}
+
+		// re-check under the lock in case the session has been renewed meanwhile.
+		expiresAt, err = b.readExpiry(id)
+		if err == nil && !now.Before(expiresAt) {
+			_ = os.Remove(b.path(id))
+		}
+
+		unlock()
+	}
+}
+
+// readExpiry reads the expiry header of the session file for the given ID.
+func (b *FileSessionBackend) readExpiry(id string) (time.Time, error) {
+	f, err := os.Open(b.path(id))
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+
+	header := make([]byte, fileSessionHeaderSize)
+
+	_, err = io.ReadFull(f, header)
+	if err != nil {
+		return time.Time{}, ErrFileSessionCorrupted
+	}
+
+	return time.Unix(0, int64(binary.BigEndian.Uint64(header))), nil
+}
+
+// encodeFileSession encodes the session record into the session file format.
+func encodeFileSession(record SessionRecord) []byte {
+	data := make([]byte, fileSessionHeaderSize, fileSessionHeaderSize+len(record.Data))
+
+	binary.BigEndian.PutUint64(data, uint64(record.ExpiresAt.UnixNano()))
+	binary.BigEndian.PutUint64(data[8:], uint64(record.Version))
+
+	return append(data, record.Data...)
+}
+
+// decodeFileSession decodes the session record from the session file format.
+func decodeFileSession(data []byte) (SessionRecord, error) {
+	if len(data) < fileSessionHeaderSize {
+		return SessionRecord{}, ErrFileSessionCorrupted
+	}
+
+	return SessionRecord{
+		Data:      data[fileSessionHeaderSize:],
+		ExpiresAt: time.Unix(0, int64(binary.BigEndian.Uint64(data))),
+		Version:   int64(binary.BigEndian.Uint64(data[8:])),
+	}, nil
+}
+
+// isValidSessionID returns true if the ID only contains characters produced by generateSessionID.
+// It prevents a forged cookie from escaping the session directory.
+func isValidSessionID(id string) bool {
+	if id == "" {
+		return false
+	}
+
+	for _, c := range id {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,245 @@
+package sess
+
+import (
+	"bytes"
+	"context"
+	"hash/fnv"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// memorySessionShardCount is the number of shards of the memory session backend.
+const memorySessionShardCount = 32
+
+// memorySessionShard is a shard of the memory session backend.
+type memorySessionShard struct {
+	mu      sync.RWMutex
+	records map[string]SessionRecord
+}
+
+// MemorySessionBackend is a sharded in-memory session backend.
+// It indexes the sessions by user.
+type MemorySessionBackend struct {
+	shards  [memorySessionShardCount]*memorySessionShard
+	indexMu sync.RWMutex
+	index   map[string]map[string]struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewMemorySessionBackend creates a new memory session backend.
+// Expired sessions are evicted every cleanupInterval by a background janitor until Close is called.
+func NewMemorySessionBackend(cleanupInterval time.Duration) *MemorySessionBackend {
+	b := &MemorySessionBackend{
+		index: map[string]map[string]struct{}{},
+		done:  make(chan struct{}),
+	}
+
+	for i := range b.shards {
+		b.shards[i] = &memorySessionShard{
+			records: map[string]SessionRecord{},
+		}
+	}
+
+	if cleanupInterval > 0 {
+		go b.janitor(cleanupInterval)
+	}
+
+	return b
+}
+
+// Load loads the session record with the given ID.
+func (b *MemorySessionBackend) Load(_ context.Context, id string) (SessionRecord, error) {
+	shard := b.shard(id)
+
+	shard.mu.RLock()
+	record, ok := shard.records[id]
+	shard.mu.RUnlock()
+
+	if !ok || !time.Now().Before(record.ExpiresAt) {
+		return SessionRecord{}, ErrSessionNotFound
+	}
+
+	record.Data = bytes.Clone(record.Data)
+
+	return record, nil
+}
+
+// Save saves the session record with the given ID if its version matches the stored one.
+func (b *MemorySessionBackend) Save(_ context.Context, id string, record SessionRecord) error {
+	return b.save(id, record, false)
+}
+
+// Touch saves the session record with the given ID if its version matches the stored one, keeping that version.
+func (b *MemorySessionBackend) Touch(_ context.Context, id string, record SessionRecord) error {
+	return b.save(id, record, true)
+}
+
+// ListByUser returns the active sessions of the given user.
+func (b *MemorySessionBackend) ListByUser(_ context.Context, userID string) ([]IndexedSession, error) {
+	b.indexMu.RLock()
+	ids := slices.Collect(maps.Keys(b.index[userID]))
+	b.indexMu.RUnlock()
+
+	now := time.Now()
+	sessions := []IndexedSession{}
+
+	for _, id := range ids {
+		shard := b.shard(id)
+
+		shard.mu.RLock()
+		record, ok := shard.records[id]
+		shard.mu.RUnlock()
+
+		if !ok || record.UserID != userID || !now.Before(record.ExpiresAt) {
+			continue
+		}
+
+		sessions = append(sessions, IndexedSession{
+			ID:         id,
+			UserID:     record.UserID,
+			CreatedAt:  record.CreatedAt,
+			LastSeenAt: record.LastSeenAt,
+			ExpiresAt:  record.ExpiresAt,
+			UserAgent:  record.UserAgent,
+			IP:         record.IP,
+		})
+	}
+
+	return sessions, nil
+}
+
+// Delete deletes the session record with the given ID.
+func (b *MemorySessionBackend) Delete(_ context.Context, id string) error {
+	shard := b.shard(id)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if record, ok := shard.records[id]; ok {
+		delete(shard.records, id)
+		b.unindex(record.UserID, id)
+	}
+
+	return nil
+}
+
+// Close stops the background janitor.
+func (b *MemorySessionBackend) Close() error {
+	b.once.Do(func() {
+		close(b.done)
+	})
+
+	return nil
+}
+
+// save saves the session record with the given ID if its version matches the stored one.
+// A touch keeps the stored version and never creates a session.
+func (b *MemorySessionBackend) save(id string, record SessionRecord, touch bool) error {
+	shard := b.shard(id)
+
+	record.Data = bytes.Clone(record.Data)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	var version int64
+
+	current, exists := shard.records[id]
+	if exists && time.Now().Before(current.ExpiresAt) {
+		version = current.Version
+	}
+
+	if record.Version != version || touch && version == 0 {
+		return ErrSessionVersionConflict
+	}
+
+	if !touch {
+		record.Version++
+	}
+
+	shard.records[id] = record
+
+	if exists && current.UserID != record.UserID {
+		b.unindex(current.UserID, id)
+	}
+
+	b.reindex(record.UserID, id)
+
+	return nil
+}
+
+// shard returns the shard responsible for the given ID.
+func (b *MemorySessionBackend) shard(id string) *memorySessionShard {
+	h := fnv.New32a()
+
+	// never returns an error.
+	_, _ = h.Write([]byte(id))
+
+	return b.shards[h.Sum32()%memorySessionShardCount]
+}
+
+// janitor periodically evicts the expired sessions.
+func (b *MemorySessionBackend) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.done:
+			return
+		case now := <-ticker.C:
+			b.evict(now)
+		}
+	}
+}
+
+// evict removes the sessions expired at the given time.
+func (b *MemorySessionBackend) evict(now time.Time) {
+	for _, shard := range b.shards {
+		shard.mu.Lock()
+
+		for id, record := range shard.records {
+			if !now.Before(record.ExpiresAt) {
+				delete(shard.records, id)
+				b.unindex(record.UserID, id)
+			}
+		}
+
+		shard.mu.Unlock()
+	}
+}
+
+// reindex adds the session to the index of the given user.
+func (b *MemorySessionBackend) reindex(userID, id string) {
+	if userID == "" {
+		return
+	}
+
+	b.indexMu.Lock()
+	defer b.indexMu.Unlock()
+
+	if b.index[userID] == nil {
+		b.index[userID] = map[string]struct{}{}
+	}
+
+	b.index[userID][id] = struct{}{}
+}
+
+// unindex removes the session from the index of the given user.
+func (b *MemorySessionBackend) unindex(userID, id string) {
+	if userID == "" {
+		return
+	}
+
+	b.indexMu.Lock()
+	defer b.indexMu.Unlock()
+
+	delete(b.index[userID], id)
+
+	if len(b.index[userID]) == 0 {
+		delete(b.index, userID)
+	}
+}
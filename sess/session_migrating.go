@@ -0,0 +1,75 @@
+package sess
+
+import (
+	"net/http"
+)
+
+// MigratingStore is a session store moving the sessions from an old store to a new one.
+// Sessions are read from the new store first and from the old store as a fallback,
+// always written to the new store, and erased from the old store once migrated.
+type MigratingStore struct {
+	oldStore SessionStore
+	newStore SessionStore
+}
+
+// NewMigratingStore creates a new store migrating sessions from the old store to the new one.
+func NewMigratingStore(oldStore, newStore SessionStore) *MigratingStore {
+	return &MigratingStore{
+		oldStore: oldStore,
+		newStore: newStore,
+	}
+}
+
+// Read reads the session from the new store or, if it has none or cannot read it, from the old store.
+// A session found in the old store is marked as modified so that it gets migrated.
+func (s *MigratingStore) Read(r *http.Request) (*Session, error) {
+	session, err := s.newStore.Read(r)
+	if err == nil && !session.isNew() {
+		return session, nil
+	}
+
+	oldSession, oldErr := s.oldStore.Read(r)
+	if oldErr != nil || oldSession.isNew() {
+		if err != nil {
+			return nil, err
+		}
+
+		return session, nil
+	}
+
+	migrated := NewSession()
+	_, _, migrated.values, _ = oldSession.snapshot()
+	migrated.modified = true
+
+	return migrated, nil
+}
+
+// Write writes the session to the new store and erases the session of the old store if any.
+func (s *MigratingStore) Write(r *http.Request, w http.ResponseWriter, session *Session) error {
+	// erase first so that the new cookie wins when both stores use the same cookie name.
+	if s.hasOldSession(r) {
+		err := s.oldStore.Erase(r, w)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.newStore.Write(r, w, session)
+}
+
+// Erase erases the session from both stores.
+func (s *MigratingStore) Erase(r *http.Request, w http.ResponseWriter) error {
+	err := s.oldStore.Erase(r, w)
+	if err != nil {
+		return err
+	}
+
+	return s.newStore.Erase(r, w)
+}
+
+// hasOldSession returns true if the request still carries a session of the old store.
+func (s *MigratingStore) hasOldSession(r *http.Request) bool {
+	session, err := s.oldStore.Read(r)
+
+	return err == nil && !session.isNew()
+}
@@ -5,52 +5,78 @@ import (
 	"fmt"
 	"net/http"
 
-	"github.com/gorilla/sessions"
+	"github.com/gorilla/securecookie"
 )
 
 var (
-	ErrSecureCookieSessionReadFailure  = errors.New("failed to read secure cookie session")
-	ErrSecureCookieSessionWriteFailure = errors.New("failed to write secure cookie session")
-	ErrSecureCookieSessionEraseFailure = errors.New("failed to erase secure cookie session")
+	ErrSecureCookieSessionDecodeFailure = errors.New("failed to decode secure cookie session")
+	ErrSecureCookieSessionReadFailure   = errors.New("failed to read secure cookie session")
+	ErrSecureCookieSessionWriteFailure  = errors.New("failed to write secure cookie session")
 )
 
 // SecureCookieSessionStore is a session store that uses secure cookies.
 type SecureCookieSessionStore struct {
-	store *sessions.CookieStore
+	codecs  []securecookie.Codec
+	options CookieOptions
 }
 
 // NewSecureCookieSessionStore creates a new secure cookie session store.
-func NewSecureCookieSessionStore(secretKey ...[]byte) *SecureCookieSessionStore {
-	store := sessions.NewCookieStore(secretKey...)
+// The secret keys are hash and encryption key pairs as expected by gorilla/securecookie.
+func NewSecureCookieSessionStore(options CookieOptions, secretKey ...[]byte) *SecureCookieSessionStore {
+	options = options.normalize()
 
-	store.Options.HttpOnly = true
+	codecs := securecookie.CodecsFromPairs(secretKey...)
 
-	return &SecureCookieSessionStore{store}
+	for _, codec := range codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			// the size is enforced by the cookie chunking instead.
+			sc.MaxLength(0)
+
+			sc.MaxAge(options.sessionMaxAge())
+		}
+	}
+
+	return &SecureCookieSessionStore{
+		codecs:  codecs,
+		options: options,
+	}
 }
 
 // Read reads the session from the request.
 func (s *SecureCookieSessionStore) Read(r *http.Request) (*Session, error) {
-	sess, err := s.store.Get(r, SessionCookieKey)
+	value, ok := s.options.readValue(r)
+	if !ok {
+		return NewSession(), nil
+	}
+
+	// the values are kept in the gorilla/sessions format for compatibility with existing cookies.
+	decoded := map[any]any{}
+
+	err := securecookie.DecodeMulti(s.options.Name, value, &decoded, s.codecs...)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrSecureCookieSessionReadFailure, err)
+		return nil, fmt.Errorf("%w: %w: %v", ErrSecureCookieSessionReadFailure, ErrSessionCorrupt, err)
 	}
 
 	session := NewSession()
 
-	for k, v := range sess.Values {
+	for k, v := range decoded {
 		key, ok := k.(string)
 		if !ok {
-			continue
+			return nil, fmt.Errorf("%w: %w: unexpected key type %T", ErrSecureCookieSessionDecodeFailure, ErrSessionCorrupt, k)
 		}
 
 		values, ok := v.([]string)
 		if !ok {
-			continue
+			return nil, fmt.Errorf(
+				"%w: %w: unexpected value type %T for key %q",
+				ErrSecureCookieSessionDecodeFailure,
+				ErrSessionCorrupt,
+				v,
+				key,
+			)
 		}
 
-		for _, value := range values {
-			session.Add(key, value)
-		}
+		session.values[key] = values
 	}
 
 	return session, nil
@@ -58,34 +84,36 @@ func (s *SecureCookieSessionStore) Read(r *http.Request) (*Session, error) {
 
 // Write writes the session to the response.
 func (s *SecureCookieSessionStore) Write(r *http.Request, w http.ResponseWriter, session *Session) error {
-	sess, _ := s.store.Get(r, SessionCookieKey)
+	_, _, sessionValues, _ := session.snapshot()
 
-	for k, v := range session.values {
+	values := map[any]any{}
+
+	for k, v := range sessionValues {
 		if len(v) == 0 {
-			delete(sess.Values, k)
 			continue
 		}
-		sess.Values[k] = v
+		values[k] = v
+	}
+
+	encoded, err := securecookie.EncodeMulti(s.options.Name, values, s.codecs...)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSecureCookieSessionWriteFailure, err)
 	}
 
-	err := sess.Save(r, w)
+	err = s.options.writeValue(r, w, encoded)
 	if err != nil {
 		return fmt.Errorf("%w: %w", ErrSecureCookieSessionWriteFailure, err)
 	}
 
+	// the cookie carries the whole session so a new cookie is a new session.
+	session.written("", 0)
+
 	return nil
 }
 
 // Erase erases the session from the response.
 func (s *SecureCookieSessionStore) Erase(r *http.Request, w http.ResponseWriter) error {
-	session, _ := s.store.Get(r, SessionCookieKey)
-
-	session.Options.MaxAge = -1
-
-	err := session.Save(r, w)
-	if err != nil {
-		return fmt.Errorf("%w: %w", ErrSecureCookieSessionEraseFailure, err)
-	}
+	s.options.eraseValue(r, w)
 
 	return nil
 }
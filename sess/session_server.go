@@ -0,0 +1,305 @@
+package sess
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+)
+
+var (
+	ErrServerSessionReadFailure  = errors.New("failed to read server session")
+	ErrServerSessionWriteFailure = errors.New("failed to write server session")
+	ErrServerSessionEraseFailure = errors.New("failed to erase server session")
+	ErrSessionNotFound           = errors.New("session not found")
+	ErrSessionVersionConflict    = errors.New("session modified concurrently")
+	ErrSessionIndexUnsupported   = errors.New("session backend does not index sessions by user")
+)
+
+// SessionRecord is the server-side representation of a session.
+type SessionRecord struct {
+	Data      []byte
+	ExpiresAt time.Time
+	// Version is incremented by the backend on every save but not on a touch.
+	Version int64
+	// Metadata of the session, provided for the backends implementing SessionIndex.
+	UserID     string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	UserAgent  string
+	IP         string
+}
+
+// IndexedSession is an active session of a user as listed by a SessionIndex.
+// Its ID is the session cookie value and must never be exposed.
+type IndexedSession struct {
+	ID         string
+	UserID     string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	UserAgent  string
+	IP         string
+}
+
+// SessionInfo describes an active session of a user.
+// The session is identified by a handle, safe to display, instead of its ID, which is a credential.
+type SessionInfo struct {
+	Handle     string
+	UserID     string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	UserAgent  string
+	IP         string
+}
+
+// SessionBackend is the interface for the storage behind a server-side session store.
+// Load must return ErrSessionNotFound when the session does not exist or has expired.
+// Save must only succeed if the stored version, zero for a missing or expired session,
+// equals the version of the record, store the record with an incremented version,
+// and return ErrSessionVersionConflict otherwise.
+// Touch records the activity on an unmodified session: it must store the record under the same conditions
+// as Save, except that a missing or expired session is a conflict, but keep the stored version so that
+// the renewal does not conflict with a concurrent modification.
+type SessionBackend interface {
+	Load(ctx context.Context, id string) (SessionRecord, error)
+	Save(ctx context.Context, id string, record SessionRecord) error
+	Touch(ctx context.Context, id string, record SessionRecord) error
+	Delete(ctx context.Context, id string) error
+}
+
+// SessionIndex is implemented by the session backends maintaining an index from users to sessions.
+type SessionIndex interface {
+	ListByUser(ctx context.Context, userID string) ([]IndexedSession, error)
+}
+
+// ServerSessionStore is a session store that keeps the session values in a backend
+// and only stores an opaque session ID in the cookie.
+type ServerSessionStore struct {
+	backend SessionBackend
+	ttl     time.Duration
+	options CookieOptions
+}
+
+// NewServerSessionStore creates a new server-side session store.
+// The ttl defines how long a session is kept in the backend after its last write.
+func NewServerSessionStore(backend SessionBackend, ttl time.Duration, options CookieOptions) *ServerSessionStore {
+	return &ServerSessionStore{
+		backend: backend,
+		ttl:     ttl,
+		options: options.normalize(),
+	}
+}
+
+// Read reads the session from the request.
+func (s *ServerSessionStore) Read(r *http.Request) (*Session, error) {
+	cookie, err := r.Cookie(s.options.Name)
+	if err != nil || cookie.Value == "" {
+		return NewSession(), nil
+	}
+
+	record, err := s.backend.Load(r.Context(), cookie.Value)
+	if errors.Is(err, ErrSessionNotFound) {
+		return NewSession(), nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrServerSessionReadFailure, backendError(err))
+	}
+
+	values, err := url.ParseQuery(string(record.Data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w: %v", ErrServerSessionReadFailure, ErrSessionCorrupt, err)
+	}
+
+	session := NewSession()
+	session.id = cookie.Value
+	session.version = record.Version
+	session.values = values
+
+	return session, nil
+}
+
+// Write writes the session to the backend and the session ID to the response.
+// It fails with ErrSessionVersionConflict if the session has been written by
+// another request since it was read, rather than overwriting its changes.
+// A renewal keeps the version of the session so that it never makes a concurrent modification fail.
+func (s *ServerSessionStore) Write(r *http.Request, w http.ResponseWriter, session *Session) error {
+	oldID, version, values, regenerate := session.snapshot()
+
+	id := oldID
+	if id == "" || regenerate {
+		id = generateSessionID()
+		version = 0
+	}
+
+	save := s.backend.Save
+	next := version + 1
+
+	if session.isRenewal() && version > 0 {
+		save = s.backend.Touch
+		next = version
+	}
+
+	err := save(r.Context(), id, SessionRecord{
+		Data:       []byte(values.Encode()),
+		ExpiresAt:  time.Now().Add(s.ttl),
+		Version:    version,
+		UserID:     values.Get(sessionUserIDKey),
+		CreatedAt:  parseSessionTime(values, sessionCreatedAtKey),
+		LastSeenAt: parseSessionTime(values, sessionLastSeenAtKey),
+		UserAgent:  r.UserAgent(),
+		IP:         remoteIP(r),
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrServerSessionWriteFailure, backendError(err))
+	}
+
+	if regenerate && oldID != "" {
+		err = s.backend.Delete(r.Context(), oldID)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrServerSessionWriteFailure, backendError(err))
+		}
+	}
+
+	session.written(id, next)
+
+	http.SetCookie(w, s.options.cookie(id))
+
+	return nil
+}
+
+// Erase erases the session from the backend and the response.
+func (s *ServerSessionStore) Erase(r *http.Request, w http.ResponseWriter) error {
+	cookie, err := r.Cookie(s.options.Name)
+	if err == nil && cookie.Value != "" {
+		err = s.backend.Delete(r.Context(), cookie.Value)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrServerSessionEraseFailure, backendError(err))
+		}
+	}
+
+	http.SetCookie(w, s.options.expiredCookie())
+
+	return nil
+}
+
+// ListUserSessions returns the active sessions of the given user.
+// The current session is the one whose handle is SessionHandle of the current session ID.
+func (s *ServerSessionStore) ListUserSessions(ctx context.Context, userID string) ([]SessionInfo, error) {
+	sessions, err := s.listByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]SessionInfo, 0, len(sessions))
+
+	for _, session := range sessions {
+		infos = append(infos, SessionInfo{
+			Handle:     SessionHandle(session.ID),
+			UserID:     session.UserID,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			ExpiresAt:  session.ExpiresAt,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+		})
+	}
+
+	return infos, nil
+}
+
+// RevokeSession deletes the session of the given user with the given handle, signing out the device using it.
+// It returns ErrSessionNotFound if the user has no such session.
+func (s *ServerSessionStore) RevokeSession(ctx context.Context, userID string, handle string) error {
+	sessions, err := s.listByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if SessionHandle(session.ID) == handle {
+			return s.backend.Delete(ctx, session.ID)
+		}
+	}
+
+	return ErrSessionNotFound
+}
+
+// RevokeUserSessions deletes all the sessions of the given user except the kept ones,
+// typically the current session ID to sign out of the other devices.
+func (s *ServerSessionStore) RevokeUserSessions(ctx context.Context, userID string, keep ...string) error {
+	sessions, err := s.listByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if slices.Contains(keep, session.ID) {
+			continue
+		}
+
+		err = s.backend.Delete(ctx, session.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SessionHandle returns the handle of the session with the given ID,
+// identifying the session without disclosing its ID.
+func SessionHandle(id string) string {
+	sum := sha256.Sum256([]byte(id))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// listByUser returns the active sessions of the given user from the backend index.
+func (s *ServerSessionStore) listByUser(ctx context.Context, userID string) ([]IndexedSession, error) {
+	index, ok := s.backend.(SessionIndex)
+	if !ok {
+		return nil, ErrSessionIndexUnsupported
+	}
+
+	return index.ListByUser(ctx, userID)
+}
+
+// backendError qualifies an error of the backend as a backend failure
+// unless it is one of the errors defined by the SessionBackend contract.
+func backendError(err error) error {
+	if errors.Is(err, ErrSessionCorrupt) || errors.Is(err, ErrSessionVersionConflict) {
+		return err
+	}
+
+	return fmt.Errorf("%w: %w", ErrSessionBackendFailure, err)
+}
+
+// remoteIP returns the IP address of the client of the request.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// generateSessionID generates a new random session ID.
+func generateSessionID() string {
+	b := make([]byte, 32)
+
+	// never returns an error.
+	_, _ = rand.Read(b)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
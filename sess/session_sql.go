@@ -0,0 +1,481 @@
+package sess
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var ErrSQLSessionTableInvalid = errors.New("invalid SQL session table name")
+
+// SQLDialect is the SQL dialect used by the SQL session backend.
+type SQLDialect int
+
+const (
+	SQLDialectSQLite SQLDialect = iota
+	SQLDialectPostgreSQL
+)
+
+// placeholder returns the n-th (1-based) query placeholder of the dialect.
+func (d SQLDialect) placeholder(n int) string {
+	if d == SQLDialectPostgreSQL {
+		return "$" + strconv.Itoa(n)
+	}
+
+	return "?"
+}
+
+// blobType returns the binary column type of the dialect.
+func (d SQLDialect) blobType() string {
+	if d == SQLDialectPostgreSQL {
+		return "BYTEA"
+	}
+
+	return "BLOB"
+}
+
+// SQLSessionStore is a server-side session store that persists sessions in a SQL database.
+type SQLSessionStore struct {
+	*ServerSessionStore
+	backend *SQLSessionBackend
+}
+
+// NewSQLSessionStore creates a new SQL session store using the given table.
+// Expired sessions are deleted every cleanupInterval until Close is called.
+func NewSQLSessionStore(
+	db *sql.DB,
+	dialect SQLDialect,
+	table string,
+	ttl time.Duration,
+	cleanupInterval time.Duration,
+	options CookieOptions,
+) (*SQLSessionStore, error) {
+	backend, err := NewSQLSessionBackend(db, dialect, table, cleanupInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SQLSessionStore{
+		ServerSessionStore: NewServerSessionStore(backend, ttl, options),
+		backend:            backend,
+	}, nil
+}
+
+// Migrate brings the session table to the latest schema, creating it if it does not exist.
+func (s *SQLSessionStore) Migrate(ctx context.Context) error {
+	return s.backend.Migrate(ctx)
+}
+
+// Cleanup deletes the expired sessions and returns how many were deleted.
+func (s *SQLSessionStore) Cleanup(ctx context.Context) (int64, error) {
+	return s.backend.Cleanup(ctx)
+}
+
+// Close stops the background cleanup.
+func (s *SQLSessionStore) Close() error {
+	return s.backend.Close()
+}
+
+// SQLSessionBackend is a session backend on top of database/sql.
+// It indexes the sessions by user.
+type SQLSessionBackend struct {
+	db      *sql.DB
+	dialect SQLDialect
+	table   string
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewSQLSessionBackend creates a new SQL session backend using the given table.
+// Expired sessions are deleted every cleanupInterval until Close is called.
+func NewSQLSessionBackend(
+	db *sql.DB,
+	dialect SQLDialect,
+	table string,
+	cleanupInterval time.Duration,
+) (*SQLSessionBackend, error) {
+	if !isValidSQLIdentifier(table) {
+		return nil, fmt.Errorf("%w: %q", ErrSQLSessionTableInvalid, table)
+	}
+
+	b := &SQLSessionBackend{
+		db:      db,
+		dialect: dialect,
+		table:   table,
+		done:    make(chan struct{}),
+	}
+
+	if cleanupInterval > 0 {
+		go b.janitor(cleanupInterval)
+	}
+
+	return b, nil
+}
+
+// migrations returns the migrations of the session table, the n-th one bringing the schema to version n+1.
+// Migrations are append-only: a released migration must never change.
+func (b *SQLSessionBackend) migrations() [][]string {
+	return [][]string{
+		{
+			fmt.Sprintf(
+				"CREATE TABLE IF NOT EXISTS %s (id VARCHAR(64) PRIMARY KEY, data %s NOT NULL, expires_at BIGINT NOT NULL)",
+				b.table,
+				b.dialect.blobType(),
+			),
+			fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_expires_at_idx ON %s (expires_at)", b.table, b.table),
+		},
+		{
+			// the existing sessions have been written once, a zero version would only allow to replace them.
+			fmt.Sprintf("ALTER TABLE %s ADD COLUMN version BIGINT NOT NULL DEFAULT 1", b.table),
+		},
+		{
+			fmt.Sprintf("ALTER TABLE %s ADD COLUMN user_id VARCHAR(255) NOT NULL DEFAULT ''", b.table),
+			fmt.Sprintf("ALTER TABLE %s ADD COLUMN created_at BIGINT NOT NULL DEFAULT 0", b.table),
+			fmt.Sprintf("ALTER TABLE %s ADD COLUMN last_seen_at BIGINT NOT NULL DEFAULT 0", b.table),
+			fmt.Sprintf("ALTER TABLE %s ADD COLUMN user_agent TEXT NOT NULL DEFAULT ''", b.table),
+			fmt.Sprintf("ALTER TABLE %s ADD COLUMN ip VARCHAR(64) NOT NULL DEFAULT ''", b.table),
+			fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_user_id_idx ON %s (user_id)", b.table, b.table),
+		},
+	}
+}
+
+// Migrate brings the session table to the latest schema, creating it if it does not exist.
+// The schema version is tracked in the <table>_schema table and each migration runs in a transaction.
+func (b *SQLSessionBackend) Migrate(ctx context.Context) error {
+	version, err := b.schemaVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to migrate session table: %w", err)
+	}
+
+	migrations := b.migrations()
+
+	for i := version; i < len(migrations); i++ {
+		err = b.migrate(ctx, i+1, migrations[i])
+		if err != nil {
+			return fmt.Errorf("failed to migrate session table to version %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// migrate runs the statements of a migration and records the resulting schema version.
+func (b *SQLSessionBackend) migrate(ctx context.Context, version int, statements []string) error {
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	// a no-op once committed.
+	defer func() { _ = tx.Rollback() }()
+
+	for _, statement := range statements {
+		_, err = tx.ExecContext(ctx, statement)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		fmt.Sprintf("UPDATE %s_schema SET version = %s", b.table, b.dialect.placeholder(1)),
+		version,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// schemaVersion returns the schema version of the session table, creating the version table if needed.
+// The version of a table created before the schema was versioned is inferred from its columns.
+func (b *SQLSessionBackend) schemaVersion(ctx context.Context) (int, error) {
+	_, err := b.db.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s_schema (version INTEGER NOT NULL)", b.table))
+	if err != nil {
+		return 0, err
+	}
+
+	var version int
+
+	err = b.db.QueryRowContext(ctx, fmt.Sprintf("SELECT version FROM %s_schema", b.table)).Scan(&version)
+	if err == nil {
+		return version, nil
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	// the latest column of each version, from the newest.
+	for i, column := range []string{"ip", "version", "id"} {
+		if b.hasColumn(ctx, column) {
+			version = 3 - i
+			break
+		}
+	}
+
+	_, err = b.db.ExecContext(
+		ctx,
+		fmt.Sprintf("INSERT INTO %s_schema (version) VALUES (%s)", b.table, b.dialect.placeholder(1)),
+		version,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// hasColumn returns true if the session table exists and has the given column.
+func (b *SQLSessionBackend) hasColumn(ctx context.Context, column string) bool {
+	rows, err := b.db.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s WHERE 1 = 0", column, b.table))
+	if err != nil {
+		return false
+	}
+
+	_ = rows.Close()
+
+	return true
+}
+
+// Load loads the session record with the given ID.
+func (b *SQLSessionBackend) Load(ctx context.Context, id string) (SessionRecord, error) {
+	query := fmt.Sprintf(
+		"SELECT data, expires_at, version FROM %s WHERE id = %s AND expires_at > %s",
+		b.table,
+		b.dialect.placeholder(1),
+		b.dialect.placeholder(2),
+	)
+
+	var (
+		data      []byte
+		expiresAt int64
+		version   int64
+	)
+
+	err := b.db.QueryRowContext(ctx, query, id, time.Now().UnixMilli()).Scan(&data, &expiresAt, &version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return SessionRecord{}, ErrSessionNotFound
+	}
+
+	if err != nil {
+		return SessionRecord{}, err
+	}
+
+	return SessionRecord{
+		Data:      data,
+		ExpiresAt: time.UnixMilli(expiresAt),
+		Version:   version,
+	}, nil
+}
+
+// Save inserts or updates the session record with the given ID if its version matches the stored one.
+// A new session replaces an expired one with the same ID.
+func (b *SQLSessionBackend) Save(ctx context.Context, id string, record SessionRecord) error {
+	if record.Version > 0 {
+		return b.update(ctx, id, record, "version + 1")
+	}
+
+	query := fmt.Sprintf(
+		"INSERT INTO %s (data, expires_at, user_id, created_at, last_seen_at, user_agent, ip, id, version) "+
+			"VALUES (%s, %s, %s, %s, %s, %s, %s, %s, 1) "+
+			"ON CONFLICT (id) DO UPDATE SET data = excluded.data, expires_at = excluded.expires_at, "+
+			"user_id = excluded.user_id, created_at = excluded.created_at, last_seen_at = excluded.last_seen_at, "+
+			"user_agent = excluded.user_agent, ip = excluded.ip, version = 1 "+
+			"WHERE %s.expires_at <= %s",
+		b.table,
+		b.dialect.placeholder(1),
+		b.dialect.placeholder(2),
+		b.dialect.placeholder(3),
+		b.dialect.placeholder(4),
+		b.dialect.placeholder(5),
+		b.dialect.placeholder(6),
+		b.dialect.placeholder(7),
+		b.dialect.placeholder(8),
+		b.table,
+		b.dialect.placeholder(9),
+	)
+
+	result, err := b.db.ExecContext(ctx, query, append(sqlSessionArgs(id, record), time.Now().UnixMilli())...)
+
+	return sqlSessionResult(result, err)
+}
+
+// Touch updates the session record with the given ID if its version matches the stored one, keeping that version.
+func (b *SQLSessionBackend) Touch(ctx context.Context, id string, record SessionRecord) error {
+	return b.update(ctx, id, record, "version")
+}
+
+// ListByUser returns the active sessions of the given user, most recently seen first.
+func (b *SQLSessionBackend) ListByUser(ctx context.Context, userID string) ([]IndexedSession, error) {
+	query := fmt.Sprintf(
+		"SELECT id, created_at, last_seen_at, expires_at, user_agent, ip FROM %s "+
+			"WHERE user_id = %s AND expires_at > %s ORDER BY last_seen_at DESC",
+		b.table,
+		b.dialect.placeholder(1),
+		b.dialect.placeholder(2),
+	)
+
+	rows, err := b.db.QueryContext(ctx, query, userID, time.Now().UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []IndexedSession{}
+
+	for rows.Next() {
+		var (
+			session                          IndexedSession
+			createdAt, lastSeenAt, expiresAt int64
+		)
+
+		err = rows.Scan(&session.ID, &createdAt, &lastSeenAt, &expiresAt, &session.UserAgent, &session.IP)
+		if err != nil {
+			return nil, err
+		}
+
+		session.UserID = userID
+		session.CreatedAt = time.UnixMilli(createdAt)
+		session.LastSeenAt = time.UnixMilli(lastSeenAt)
+		session.ExpiresAt = time.UnixMilli(expiresAt)
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// Delete deletes the session record with the given ID.
+func (b *SQLSessionBackend) Delete(ctx context.Context, id string) error {
+	query := fmt.Sprintf(
+		"DELETE FROM %s WHERE id = %s",
+		b.table,
+		b.dialect.placeholder(1),
+	)
+
+	_, err := b.db.ExecContext(ctx, query, id)
+
+	return err
+}
+
+// Cleanup deletes the expired sessions and returns how many were deleted.
+func (b *SQLSessionBackend) Cleanup(ctx context.Context) (int64, error) {
+	query := fmt.Sprintf(
+		"DELETE FROM %s WHERE expires_at <= %s",
+		b.table,
+		b.dialect.placeholder(1),
+	)
+
+	result, err := b.db.ExecContext(ctx, query, time.Now().UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// Close stops the background cleanup.
+func (b *SQLSessionBackend) Close() error {
+	b.once.Do(func() {
+		close(b.done)
+	})
+
+	return nil
+}
+
+// janitor periodically deletes the expired sessions.
+func (b *SQLSessionBackend) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+			_, _ = b.Cleanup(context.Background())
+		}
+	}
+}
+
+// update updates the unexpired session record with the given ID if its version matches the stored one,
+// setting the version to the given expression.
+func (b *SQLSessionBackend) update(ctx context.Context, id string, record SessionRecord, version string) error {
+	query := fmt.Sprintf(
+		"UPDATE %s SET data = %s, expires_at = %s, user_id = %s, created_at = %s, last_seen_at = %s, "+
+			"user_agent = %s, ip = %s, version = %s "+
+			"WHERE id = %s AND expires_at > %s AND version = %s",
+		b.table,
+		b.dialect.placeholder(1),
+		b.dialect.placeholder(2),
+		b.dialect.placeholder(3),
+		b.dialect.placeholder(4),
+		b.dialect.placeholder(5),
+		b.dialect.placeholder(6),
+		b.dialect.placeholder(7),
+		version,
+		b.dialect.placeholder(8),
+		b.dialect.placeholder(9),
+		b.dialect.placeholder(10),
+	)
+
+	args := append(sqlSessionArgs(id, record), time.Now().UnixMilli(), record.Version)
+
+	result, err := b.db.ExecContext(ctx, query, args...)
+
+	return sqlSessionResult(result, err)
+}
+
+// sqlSessionArgs returns the query arguments of the session record with the given ID,
+// in the order of the columns written by Save.
+func sqlSessionArgs(id string, record SessionRecord) []any {
+	return []any{
+		record.Data,
+		record.ExpiresAt.UnixMilli(),
+		record.UserID,
+		record.CreatedAt.UnixMilli(),
+		record.LastSeenAt.UnixMilli(),
+		record.UserAgent,
+		record.IP,
+		id,
+	}
+}
+
+// sqlSessionResult returns ErrSessionVersionConflict if the write of a session record affected no row.
+func sqlSessionResult(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrSessionVersionConflict
+	}
+
+	return nil
+}
+
+// isValidSQLIdentifier returns true if the name can safely be interpolated as a SQL identifier.
+func isValidSQLIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for i, c := range name {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_' || i > 0 && '0' <= c && c <= '9') {
+			return false
+		}
+	}
+
+	return true
+}
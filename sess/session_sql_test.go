@@ -0,0 +1,242 @@
+package sess
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// newTestSQLSessionBackend returns a SQL session backend on a new SQLite database
+// after running the given statements, typically to create a table of an older schema.
+func newTestSQLSessionBackend(t *testing.T, statements ...string) *SQLSessionBackend {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "sessions.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = db.Close() })
+
+	for _, statement := range statements {
+		_, err = db.Exec(statement)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backend, err := NewSQLSessionBackend(db, SQLDialectSQLite, "sessions", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return backend
+}
+
+func TestSQLSessionBackendMigrate(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour).UnixMilli()
+
+	schemas := map[string][]string{
+		"none": nil,
+		"id, data and expiry": {
+			"CREATE TABLE sessions (id VARCHAR(64) PRIMARY KEY, data BLOB NOT NULL, expires_at BIGINT NOT NULL)",
+			"CREATE INDEX sessions_expires_at_idx ON sessions (expires_at)",
+			"INSERT INTO sessions (id, data, expires_at) VALUES ('existing', 'k=v', " + itoa(expiresAt) + ")",
+		},
+		"version": {
+			"CREATE TABLE sessions " +
+				"(id VARCHAR(64) PRIMARY KEY, data BLOB NOT NULL, expires_at BIGINT NOT NULL, version BIGINT NOT NULL)",
+			"CREATE INDEX sessions_expires_at_idx ON sessions (expires_at)",
+			"INSERT INTO sessions (id, data, expires_at, version) VALUES ('existing', 'k=v', " + itoa(expiresAt) + ", 1)",
+		},
+		"user index": {
+			"CREATE TABLE sessions " +
+				"(id VARCHAR(64) PRIMARY KEY, data BLOB NOT NULL, expires_at BIGINT NOT NULL, version BIGINT NOT NULL, " +
+				"user_id VARCHAR(255) NOT NULL, created_at BIGINT NOT NULL, last_seen_at BIGINT NOT NULL, " +
+				"user_agent TEXT NOT NULL, ip VARCHAR(64) NOT NULL)",
+			"CREATE INDEX sessions_user_id_idx ON sessions (user_id)",
+			"CREATE INDEX sessions_expires_at_idx ON sessions (expires_at)",
+			"INSERT INTO sessions (id, data, expires_at, version, user_id, created_at, last_seen_at, user_agent, ip) " +
+				"VALUES ('existing', 'k=v', " + itoa(expiresAt) + ", 1, '', 0, 0, '', '')",
+		},
+	}
+
+	for name, statements := range schemas {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			backend := newTestSQLSessionBackend(t, statements...)
+
+			// migrating twice is a no-op.
+			for range 2 {
+				err := backend.Migrate(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var version int
+
+			err := backend.db.QueryRow("SELECT version FROM sessions_schema").Scan(&version)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if version != len(backend.migrations()) {
+				t.Errorf("got schema version %d, want %d", version, len(backend.migrations()))
+			}
+
+			if statements != nil {
+				record, err := backend.Load(ctx, "existing")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if string(record.Data) != "k=v" || record.Version != 1 {
+					t.Errorf("got data %q and version %d, want %q and 1", record.Data, record.Version, "k=v")
+				}
+
+				record.UserID = "user"
+
+				err = backend.Save(ctx, "existing", record)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = backend.Save(ctx, "new", SessionRecord{
+				Data:      []byte("k=v"),
+				ExpiresAt: time.Now().Add(time.Hour),
+				UserID:    "user",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sessions, err := backend.ListByUser(ctx, "user")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := 1
+			if statements != nil {
+				want = 2
+			}
+
+			if len(sessions) != want {
+				t.Errorf("got %d sessions, want %d", len(sessions), want)
+			}
+		})
+	}
+}
+
+func TestSQLSessionBackendVersionConflict(t *testing.T) {
+	ctx := context.Background()
+	backend := newTestSQLSessionBackend(t)
+
+	err := backend.Migrate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record := SessionRecord{
+		Data:      []byte("k=v"),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+
+	err = backend.Save(ctx, "id", record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a new session cannot replace an active one.
+	err = backend.Save(ctx, "id", record)
+	if !errors.Is(err, ErrSessionVersionConflict) {
+		t.Errorf("got %v, want %v", err, ErrSessionVersionConflict)
+	}
+
+	record.Version = 1
+
+	err = backend.Touch(ctx, "id", record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = backend.Save(ctx, "id", record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the version has been incremented by the save but not by the touch.
+	for _, write := range []func(context.Context, string, SessionRecord) error{backend.Save, backend.Touch} {
+		err = write(ctx, "id", record)
+		if !errors.Is(err, ErrSessionVersionConflict) {
+			t.Errorf("got %v, want %v", err, ErrSessionVersionConflict)
+		}
+	}
+
+	stored, err := backend.Load(ctx, "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stored.Version != 2 {
+		t.Errorf("got version %d, want 2", stored.Version)
+	}
+
+	// a touch never creates a session.
+	err = backend.Touch(ctx, "missing", record)
+	if !errors.Is(err, ErrSessionVersionConflict) {
+		t.Errorf("got %v, want %v", err, ErrSessionVersionConflict)
+	}
+}
+
+func TestSQLSessionBackendReplaceExpired(t *testing.T) {
+	ctx := context.Background()
+	backend := newTestSQLSessionBackend(t)
+
+	err := backend.Migrate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = backend.Save(ctx, "id", SessionRecord{
+		Data:      []byte("k=expired"),
+		ExpiresAt: time.Now().Add(-time.Second),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = backend.Load(ctx, "id")
+	if !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("got %v, want %v", err, ErrSessionNotFound)
+	}
+
+	err = backend.Save(ctx, "id", SessionRecord{
+		Data:      []byte("k=new"),
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := backend.Load(ctx, "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(record.Data) != "k=new" || record.Version != 1 {
+		t.Errorf("got data %q and version %d, want %q and 1", record.Data, record.Version, "k=new")
+	}
+}
+
+// itoa formats the integer for a SQL statement.
+func itoa(i int64) string {
+	return strconv.FormatInt(i, 10)
+}
@@ -0,0 +1,42 @@
+package sess
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrSessionValueDecodeFailure = errors.New("failed to decode session value")
+	ErrSessionValueEncodeFailure = errors.New("failed to encode session value")
+	ErrSessionValueMissing       = errors.New("missing session value")
+)
+
+// GetValue returns the value stored with SetValue for the given key.
+func GetValue[T any](s *Session, key string) (T, error) {
+	var value T
+
+	if s.Empty(key) {
+		return value, fmt.Errorf("%w: %q", ErrSessionValueMissing, key)
+	}
+
+	err := json.Unmarshal([]byte(s.GetFirst(key)), &value)
+	if err != nil {
+		return value, fmt.Errorf("%w: %q: %w", ErrSessionValueDecodeFailure, key, err)
+	}
+
+	return value, nil
+}
+
+// SetValue stores the JSON encoding of the value in the session for the given key.
+// As any other session value, it is persisted by every session store.
+func SetValue[T any](s *Session, key string, value T) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("%w: %q: %w", ErrSessionValueEncodeFailure, key, err)
+	}
+
+	s.Reset(key, string(data))
+
+	return nil
+}